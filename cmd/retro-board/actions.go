@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Action statuses.
+const (
+	actionOpen    = "open"
+	actionDone    = "done"
+	actionDropped = "dropped"
+)
+
+// CreateAction creates a new action item, open unless told otherwise.
+func (r *memoryRepo) CreateAction(boardId string, action *Action) (*Action, error) {
+	b, err := r.lockBoardFor(boardId, opEditActions)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	created := *action
+	created.Id = uuid.New().String()
+	created.Version = b.Version + 1
+	created.CarriedFrom = ""
+	if created.Status == "" {
+		created.Status = actionOpen
+	}
+	if err := checkAction(&created); err != nil {
+		return nil, err
+	}
+	if _, ok := b.Items[created.ItemId]; created.ItemId != "" && !ok {
+		return nil, errors.New("item_not_found")
+	}
+
+	state := b.clone()
+	if state.Actions == nil {
+		state.Actions = make(map[string]*Action)
+	}
+	state.Actions[created.Id] = &created
+	if err := r.updateActions(b, state, created.Id); err != nil {
+		return nil, err
+	}
+
+	ret := created
+	return &ret, nil
+}
+
+// UpdateAction changes the title, assignee, due date and status of an
+// action item.
+func (r *memoryRepo) UpdateAction(boardId string, actionId string, action *Action) (*Action, error) {
+	b, err := r.lockBoardFor(boardId, opEditActions)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if _, ok := b.Actions[actionId]; !ok {
+		return nil, errors.New("action_not_found")
+	}
+
+	state := b.clone()
+	updated := state.Actions[actionId]
+	updated.Title = action.Title
+	updated.Assignee = action.Assignee
+	updated.DueDate = action.DueDate
+	updated.Status = action.Status
+	updated.Version = b.Version + 1
+	if err := checkAction(updated); err != nil {
+		return nil, err
+	}
+	if err := r.updateActions(b, state, actionId); err != nil {
+		return nil, err
+	}
+
+	ret := *updated
+	return &ret, nil
+}
+
+// DeleteAction deletes an action item and returns it.
+func (r *memoryRepo) DeleteAction(boardId string, actionId string) (*Action, error) {
+	b, err := r.lockBoardFor(boardId, opEditActions)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	deleted, ok := b.Actions[actionId]
+	if !ok {
+		return nil, errors.New("action_not_found")
+	}
+
+	state := b.clone()
+	delete(state.Actions, actionId)
+	if err := r.updateActions(b, state, actionId); err != nil {
+		return nil, err
+	}
+
+	ret := *deleted
+	return &ret, nil
+}
+
+// CarryOverActions copies the open action items of a board into another.
+// The copies remember the board they came from.
+func (r *memoryRepo) CarryOverActions(boardId string, fromBoardId string) (*Board, error) {
+	if boardId == fromBoardId {
+		return nil, errors.New("input_error")
+	}
+
+	// The boards are locked one at a time.
+	from, err := r.lockBoard(fromBoardId)
+	if err != nil {
+		return nil, err
+	}
+	var open []Action
+	for _, a := range from.Actions {
+		if a.Status == actionOpen {
+			open = append(open, *a)
+		}
+	}
+	from.Mutex.Unlock()
+
+	b, err := r.lockBoardFor(boardId, opEditActions)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if len(open) == 0 {
+		return b, nil
+	}
+
+	state := b.clone()
+	if state.Actions == nil {
+		state.Actions = make(map[string]*Action)
+	}
+	var ids []string
+	for i := range open {
+		a := &open[i]
+		a.Id = uuid.New().String()
+		a.Version = b.Version + 1
+		// Actions carried again keep the board of their card.
+		if a.CarriedFrom == "" {
+			a.CarriedFrom = fromBoardId
+		}
+		state.Actions[a.Id] = a
+		ids = append(ids, a.Id)
+	}
+	if err := r.updateActions(b, state, ids...); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// checkAction checks the status and the due date of an action item.
+func checkAction(a *Action) error {
+	switch a.Status {
+	case actionOpen, actionDone, actionDropped:
+	default:
+		return errors.New("invalid_status")
+	}
+	if a.DueDate != "" {
+		if _, err := time.Parse("2006-01-02", a.DueDate); err != nil {
+			return errors.New("invalid_due_date")
+		}
+	}
+	return nil
+}
+
+// unlinkItem clears the card of the action items which came from an item
+// of the board, giving them the version. Returns the ids of the actions.
+func unlinkItem(state *BoardState, itemId string, version uint64) []string {
+	var ids []string
+	for id, a := range state.Actions {
+		if a.ItemId == itemId && a.CarriedFrom == "" {
+			a.ItemId = ""
+			a.Version = version
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// updateActions stores the board state, records the changed action items
+// and notifies the listeners.
+// Must be called while holding the board lock.
+func (r *memoryRepo) updateActions(b *Board, state BoardState, actionIds ...string) error {
+	if err := r.store.UpdateBoard(b.Id, b.Version+1, &state); err != nil {
+		return err
+	}
+	b.BoardState = state
+
+	r.recordActions(b, actionIds...)
+	r.commit(b)
+
+	return nil
+}
+
+// recordActions records the action items changed with the upcoming version.
+// Must be called while holding the board lock.
+func (r *memoryRepo) recordActions(b *Board, actionIds ...string) {
+	for _, id := range actionIds {
+		b.changes = append(b.changes, Change{Version: b.Version + 1, ActionId: id})
+	}
+}
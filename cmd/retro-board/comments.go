@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AddComment adds a comment of a participant to the thread of an item.
+func (r *memoryRepo) AddComment(boardId string, itemId string, comment *Comment) (*Comment, error) {
+	if comment.Text == "" {
+		return nil, errors.New("input_error")
+	}
+
+	b, err := r.lockBoardFor(boardId, opComment)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	created := Comment{
+		Id:        uuid.New().String(),
+		Author:    comment.Author,
+		Text:      comment.Text,
+		CreatedAt: time.Now().UTC(),
+	}
+	updated := *oItem.clone()
+	updated.Comments = append(updated.Comments, created)
+	if _, err := r.replaceItem(b, oItem, updated); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// EditComment changes the text of a comment. Only the author can, if the
+// comment has one.
+func (r *memoryRepo) EditComment(boardId string, itemId string, commentId string, comment *Comment) (*Comment, error) {
+	if comment.Text == "" {
+		return nil, errors.New("input_error")
+	}
+
+	b, err := r.lockBoardFor(boardId, opComment)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+	i, err := findComment(oItem, commentId, comment.Author)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *oItem.clone()
+	now := time.Now().UTC()
+	edited := &updated.Comments[i]
+	edited.Text = comment.Text
+	edited.UpdatedAt = &now
+	if _, err := r.replaceItem(b, oItem, updated); err != nil {
+		return nil, err
+	}
+
+	ret := *edited
+	return &ret, nil
+}
+
+// DeleteComment deletes a comment and returns it. Only the author can, if
+// the comment has one.
+func (r *memoryRepo) DeleteComment(boardId string, itemId string, commentId string, participantId string) (*Comment, error) {
+	b, err := r.lockBoardFor(boardId, opComment)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+	i, err := findComment(oItem, commentId, participantId)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *oItem.clone()
+	deleted := updated.Comments[i]
+	updated.Comments = append(updated.Comments[:i], updated.Comments[i+1:]...)
+	if _, err := r.replaceItem(b, oItem, updated); err != nil {
+		return nil, err
+	}
+
+	return &deleted, nil
+}
+
+// findComment finds the position of a comment of an item which the
+// participant may change.
+func findComment(it *Item, commentId string, participantId string) (int, error) {
+	for i, c := range it.Comments {
+		if c.Id != commentId {
+			continue
+		}
+		if c.Author != "" && c.Author != participantId {
+			return -1, ErrNotAuthor
+		}
+		return i, nil
+	}
+	return -1, errors.New("comment_not_found")
+}
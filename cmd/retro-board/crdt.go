@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// Text operation types.
+const (
+	textInsert = "insert"
+	textDelete = "delete"
+)
+
+// serverSite is the site of the characters the server creates. It is also
+// the site of the characters of a text before it is first edited, which are
+// numbered from 1 in order.
+const serverSite = ""
+
+// TextId identifies a character of a text document.
+// The counter is a Lamport clock of the site that created the character.
+type TextId struct {
+	Counter uint64 `json:"counter"`
+	Site    string `json:"site"`
+}
+
+// isZero tells whether the id is the head of the document.
+func (id TextId) isZero() bool {
+	return id.Counter == 0 && id.Site == ""
+}
+
+// less orders the ids, the greater id wins the position.
+func (id TextId) less(other TextId) bool {
+	if id.Counter != other.Counter {
+		return id.Counter < other.Counter
+	}
+	return id.Site < other.Site
+}
+
+// TextChar is a character of a text document.
+// Deleted characters are kept as tombstones.
+type TextChar struct {
+	Id      TextId `json:"id"`
+	Char    string `json:"char"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// TextOp is a character level operation on a text document.
+// Insert puts the character with the id after the one with the after id,
+// or at the head if it is zero. Delete removes the character with the id.
+type TextOp struct {
+	Type  string `json:"type"`
+	Id    TextId `json:"id"`
+	After TextId `json:"after,omitempty"`
+	Char  string `json:"char,omitempty"`
+	// Version is the board version the operation is merged at.
+	Version uint64 `json:"version"`
+}
+
+// TextDoc is the text of an item as a replicated growable array (RGA),
+// so that concurrent character edits merge without conflicts.
+type TextDoc struct {
+	Chars []TextChar `json:"chars"`
+	// ops are the merged operations, kept to deliver them as changes.
+	ops []TextOp
+}
+
+// newTextDoc makes a document of a text which has not been edited yet.
+func newTextDoc(text string) *TextDoc {
+	d := &TextDoc{Chars: []TextChar{}}
+	var counter uint64
+	for _, r := range text {
+		counter++
+		d.Chars = append(d.Chars, TextChar{
+			Id:   TextId{Counter: counter, Site: serverSite},
+			Char: string(r),
+		})
+	}
+	return d
+}
+
+// clone copies the document.
+func (d *TextDoc) clone() *TextDoc {
+	c := &TextDoc{
+		Chars: make([]TextChar, len(d.Chars)),
+		ops:   make([]TextOp, len(d.ops)),
+	}
+	copy(c.Chars, d.Chars)
+	copy(c.ops, d.ops)
+	return c
+}
+
+// text returns the visible text.
+func (d *TextDoc) text() string {
+	buf := make([]byte, 0, len(d.Chars))
+	for _, c := range d.Chars {
+		if !c.Deleted {
+			buf = append(buf, c.Char...)
+		}
+	}
+	return string(buf)
+}
+
+// index finds the position of a character, -1 if it is not there.
+func (d *TextDoc) index(id TextId) int {
+	for i, c := range d.Chars {
+		if c.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// maxCounter is the greatest counter in the document.
+func (d *TextDoc) maxCounter() uint64 {
+	var counter uint64
+	for _, c := range d.Chars {
+		if c.Id.Counter > counter {
+			counter = c.Id.Counter
+		}
+	}
+	return counter
+}
+
+// apply merges an operation into the document at the given version.
+// Applying an insert twice changes nothing.
+func (d *TextDoc) apply(op TextOp, version uint64) error {
+	switch op.Type {
+	case textInsert:
+		if op.Id.Counter == 0 || utf8.RuneCountInString(op.Char) != 1 {
+			return errors.New("invalid_text_op")
+		}
+		if d.index(op.Id) >= 0 {
+			return nil
+		}
+
+		pos := 0
+		if !op.After.isZero() {
+			i := d.index(op.After)
+			if i < 0 {
+				return errors.New("invalid_text_op")
+			}
+			pos = i + 1
+		}
+		// Concurrent inserts at the same place are ordered by id.
+		for pos < len(d.Chars) && op.Id.less(d.Chars[pos].Id) {
+			pos++
+		}
+
+		d.Chars = append(d.Chars, TextChar{})
+		copy(d.Chars[pos+1:], d.Chars[pos:])
+		d.Chars[pos] = TextChar{Id: op.Id, Char: op.Char}
+
+	case textDelete:
+		i := d.index(op.Id)
+		if i < 0 {
+			return errors.New("invalid_text_op")
+		}
+		d.Chars[i].Deleted = true
+
+	default:
+		return errors.New("invalid_text_op")
+	}
+
+	op.Version = version
+	d.ops = append(d.ops, op)
+	return nil
+}
+
+// setText turns a plain text change into operations of the server site,
+// keeping the common start and end of the text.
+func (d *TextDoc) setText(text string, version uint64) {
+	var visible []int
+	for i, c := range d.Chars {
+		if !c.Deleted {
+			visible = append(visible, i)
+		}
+	}
+	runes := []rune(text)
+
+	// Find the changed middle part.
+	prefix := 0
+	for prefix < len(visible) && prefix < len(runes) &&
+		d.Chars[visible[prefix]].Char == string(runes[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(visible)-prefix && suffix < len(runes)-prefix &&
+		d.Chars[visible[len(visible)-1-suffix]].Char == string(runes[len(runes)-1-suffix]) {
+		suffix++
+	}
+
+	var ops []TextOp
+	for _, i := range visible[prefix : len(visible)-suffix] {
+		ops = append(ops, TextOp{Type: textDelete, Id: d.Chars[i].Id})
+	}
+
+	after := TextId{}
+	if prefix > 0 {
+		after = d.Chars[visible[prefix-1]].Id
+	}
+	counter := d.maxCounter()
+	for _, r := range runes[prefix : len(runes)-suffix] {
+		counter++
+		id := TextId{Counter: counter, Site: serverSite}
+		ops = append(ops, TextOp{Type: textInsert, Id: id, After: after, Char: string(r)})
+		after = id
+	}
+
+	for _, op := range ops {
+		// The operations are valid by construction.
+		d.apply(op, version)
+	}
+}
+
+// trimOps drops the operations merged up to the given version.
+func (d *TextDoc) trimOps(version uint64) {
+	var ops []TextOp
+	for _, op := range d.ops {
+		if op.Version > version {
+			ops = append(ops, op)
+		}
+	}
+	d.ops = ops
+}
+
+// opsSince returns the operations merged after the given version.
+func (d *TextDoc) opsSince(version uint64) []TextOp {
+	var ops []TextOp
+	for _, op := range d.ops {
+		if op.Version > version {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextDocConcurrentEdits(t *testing.T) {
+	head := TextId{}
+	first := TextId{Counter: 1, Site: serverSite}
+	ops := []TextOp{
+		{Type: textInsert, Id: TextId{Counter: 4, Site: "alice"}, After: first, Char: "a"},
+		{Type: textInsert, Id: TextId{Counter: 4, Site: "bob"}, After: first, Char: "b"},
+		{Type: textInsert, Id: TextId{Counter: 5, Site: "bob"}, After: TextId{Counter: 4, Site: "bob"}, Char: "c"},
+		{Type: textInsert, Id: TextId{Counter: 6, Site: "alice"}, After: head, Char: "d"},
+		{Type: textDelete, Id: TextId{Counter: 3, Site: serverSite}},
+	}
+
+	// The same operations in any causal order give the same text.
+	orders := [][]int{
+		{0, 1, 2, 3, 4},
+		{1, 2, 0, 4, 3},
+		{4, 3, 1, 0, 2},
+	}
+	for _, order := range orders {
+		d := newTextDoc("xyz")
+		for _, i := range order {
+			assert.NoError(t, d.apply(ops[i], 1))
+		}
+		assert.Equal(t, "dxbcay", d.text())
+	}
+
+	// Inserts are idempotent.
+	d := newTextDoc("xyz")
+	assert.NoError(t, d.apply(ops[0], 1))
+	assert.NoError(t, d.apply(ops[0], 2))
+	assert.Equal(t, "xayz", d.text())
+	assert.Len(t, d.opsSince(1), 0)
+
+	invalidOps := []TextOp{
+		{Type: "replace", Id: TextId{Counter: 7, Site: "alice"}, Char: "e"},
+		{Type: textInsert, Id: TextId{Counter: 7, Site: "alice"}, Char: "ef"},
+		{Type: textInsert, Id: TextId{Counter: 7, Site: "alice"}, After: TextId{Counter: 9, Site: "bob"}, Char: "e"},
+		{Type: textDelete, Id: TextId{Counter: 9, Site: "bob"}},
+	}
+	for _, op := range invalidOps {
+		assert.Error(t, d.apply(op, 3))
+	}
+}
+
+func TestTextDocSetText(t *testing.T) {
+	d := newTextDoc("hello world")
+	d.setText("hello there world", 1)
+	assert.Equal(t, "hello there world", d.text())
+	d.setText("hi world", 2)
+	assert.Equal(t, "hi world", d.text())
+
+	// The unchanged characters keep their ids.
+	assert.Equal(t, TextId{Counter: 1, Site: serverSite}, d.Chars[0].Id)
+	assert.Equal(t, TextId{Counter: 11, Site: serverSite}, d.Chars[len(d.Chars)-1].Id)
+
+	// A replica catches up with the operations.
+	replica := newTextDoc("hello world")
+	for _, op := range d.opsSince(0) {
+		assert.NoError(t, replica.apply(op, op.Version))
+	}
+	assert.Equal(t, d.Chars, replica.Chars)
+	// Ten deletes and an insert at version 2.
+	assert.Len(t, d.opsSince(1), 11)
+
+	d.trimOps(1)
+	assert.Len(t, d.ops, 11)
+	d.trimOps(2)
+	assert.Empty(t, d.ops)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// cursorInterval is the least time between the cursor messages of
+	// a client, of the ones coming faster only the last is relayed.
+	cursorInterval = time.Second / 30
+	// cursorBuffer is how many cursor messages wait for a slow client
+	// before more are dropped.
+	cursorBuffer = 32
+)
+
+// cursorHub relays the cursors between the sockets of each board. Cursors
+// are not versioned nor stored, what a slow client can't take is dropped.
+type cursorHub struct {
+	mutex  sync.Mutex
+	boards map[string]map[*socket]bool
+}
+
+func newCursorHub() *cursorHub {
+	return &cursorHub{boards: make(map[string]map[*socket]bool)}
+}
+
+// join starts relaying the cursors of a board to a socket.
+func (c *cursorHub) join(boardId string, s *socket) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	sockets, ok := c.boards[boardId]
+	if !ok {
+		sockets = make(map[*socket]bool)
+		c.boards[boardId] = sockets
+	}
+	sockets[s] = true
+}
+
+// leave stops relaying the cursors of a board to a socket.
+func (c *cursorHub) leave(boardId string, s *socket) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.boards[boardId], s)
+	if len(c.boards[boardId]) == 0 {
+		delete(c.boards, boardId)
+	}
+}
+
+// relay sends a cursor to the other sockets of a board.
+func (c *cursorHub) relay(boardId string, from *socket, cursor *Cursor) {
+	msg := SocketMessage{Type: msgCursor, Cursor: cursor}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for s := range c.boards[boardId] {
+		if s == from {
+			continue
+		}
+		select {
+		case s.cursors <- msg:
+		default:
+			// The client is behind, newer cursors will follow.
+		}
+	}
+}
+
+// handleCursor relays the cursor of the participant of a socket. A cursor
+// coming faster than cursorInterval waits for the interval to pass, and is
+// replaced by the ones coming meanwhile. Returns an error message, if any.
+func (h *handler) handleCursor(b *Board, s *socket, msg *SocketMessage) *SocketMessage {
+	if msg.Cursor == nil {
+		return &SocketMessage{Type: msgError, Error: "Missing input error"}
+	}
+	if s.participant == "" {
+		return &SocketMessage{Type: msgError, Error: "missing_participant"}
+	}
+
+	// No impersonating.
+	cursor := *msg.Cursor
+	cursor.ParticipantId = s.participant
+
+	s.cursorMutex.Lock()
+	defer s.cursorMutex.Unlock()
+
+	wait := cursorInterval - time.Since(s.lastCursor)
+	if wait > 0 {
+		s.pendingCursor = &cursor
+		if s.cursorTimer == nil {
+			s.cursorTimer = time.AfterFunc(wait, func() { h.flushCursor(b.Id, s) })
+		}
+		return nil
+	}
+
+	s.lastCursor = time.Now()
+	h.cursors.relay(b.Id, s, &cursor)
+
+	return nil
+}
+
+// flushCursor relays the cursor of a socket that waited for the interval,
+// if the socket is not closed meanwhile.
+func (h *handler) flushCursor(boardId string, s *socket) {
+	s.cursorMutex.Lock()
+	defer s.cursorMutex.Unlock()
+
+	s.cursorTimer = nil
+	if s.pendingCursor == nil {
+		return
+	}
+	s.lastCursor = time.Now()
+	h.cursors.relay(boardId, s, s.pendingCursor)
+	s.pendingCursor = nil
+}
+
+// stopCursor drops the cursor of a socket waiting to be relayed.
+func (s *socket) stopCursor() {
+	s.cursorMutex.Lock()
+	defer s.cursorMutex.Unlock()
+
+	if s.cursorTimer != nil {
+		s.cursorTimer.Stop()
+		s.cursorTimer = nil
+	}
+	s.pendingCursor = nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// boardEvents streams the changes in specified board id as server-sent events.
+// Each event holds a board object with the items changed since the previous
+// event and has the board version as its id. A reconnecting client resumes
+// after the version in the Last-Event-ID header, a new client gets the whole
+// board first. The stream ends with an error event if the board is deleted.
+// The client sees the board as the participant connecting.
+func (h *handler) boardEvents(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["board-id"]
+	viewer, _ := participantId(r)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, errors.New("streaming_unsupported"))
+		return
+	}
+
+	b, err := h.repo.GetBoard(id)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, err)
+		return
+	}
+
+	// Resume from the last received version, if any.
+	var version uint64
+	resume := r.Header.Get("Last-Event-ID")
+	if resume != "" {
+		version, err = strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, errors.New("invalid_argument_version"))
+			return
+		}
+	}
+
+	// The participant is online while connected.
+	defer h.keepPresent(r, id)()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if resume == "" {
+		view := boardView(b, viewer)
+		version = view.Version
+		if writeEvent(w, version, view) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		// Wake up now and then to keep the connection alive.
+		ctx, cancel := context.WithTimeout(r.Context(), h.pollTimeout)
+		updates, err := h.repo.GetBoardUpdates(ctx, b, version)
+		cancel()
+
+		if errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil {
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			continue
+		}
+		if errors.Is(err, ErrBoardDeleted) {
+			writeErrorEvent(w, err)
+			flusher.Flush()
+			return
+		}
+		if err != nil {
+			// The client is gone.
+			return
+		}
+
+		version = updates.Version
+		if writeEvent(w, version, viewBoard(updates, viewer)) != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a board event with the version as its id.
+func writeEvent(w http.ResponseWriter, version uint64, b *Board) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: board\ndata: %s\n\n", version, data)
+	return err
+}
+
+// writeErrorEvent writes an error event.
+func writeErrorEvent(w http.ResponseWriter, err error) error {
+	data, _ := json.Marshal(ErrorResponse{Error: err.Error()})
+
+	_, err = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	return err
+}
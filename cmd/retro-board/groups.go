@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// CreateGroup creates a new group of items. The items are taken out of
+// the groups they were in. The groups returned here and below carry the
+// votes of their items, as in the board updates.
+func (r *memoryRepo) CreateGroup(boardId string, group *Group) (*Group, error) {
+	b, err := r.lockBoardFor(boardId, opGroupItems)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	created := group.clone()
+	created.Id = uuid.New().String()
+	created.Version = b.Version + 1
+	created.Votes = nil
+	if created.Items == nil {
+		created.Items = []string{}
+	}
+
+	state := b.clone()
+	changed := []string{created.Id}
+	seen := make(map[string]bool)
+	for _, itemId := range created.Items {
+		if _, ok := b.Items[itemId]; !ok {
+			return nil, errors.New("item_not_found")
+		}
+		if seen[itemId] {
+			return nil, errors.New("input_error")
+		}
+		seen[itemId] = true
+		if id := ungroupItem(&state, itemId, created.Version); id != "" {
+			changed = append(changed, id)
+		}
+	}
+
+	if state.Groups == nil {
+		state.Groups = make(map[string]*Group)
+	}
+	state.Groups[created.Id] = created
+	if err := r.updateGroups(b, state, changed...); err != nil {
+		return nil, err
+	}
+
+	return groupView(b, created), nil
+}
+
+// UpdateGroup changes the title and the bounding box of a group.
+func (r *memoryRepo) UpdateGroup(boardId string, groupId string, group *Group) (*Group, error) {
+	b, err := r.lockBoardFor(boardId, opGroupItems)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if _, ok := b.Groups[groupId]; !ok {
+		return nil, errors.New("group_not_found")
+	}
+
+	state := b.clone()
+	updated := state.Groups[groupId]
+	updated.Title = group.Title
+	updated.Left = group.Left
+	updated.Top = group.Top
+	updated.Width = group.Width
+	updated.Height = group.Height
+	updated.Version = b.Version + 1
+	if err := r.updateGroups(b, state, groupId); err != nil {
+		return nil, err
+	}
+
+	return groupView(b, updated), nil
+}
+
+// DissolveGroup deletes a group and returns it. The items of the group
+// are left without a group.
+func (r *memoryRepo) DissolveGroup(boardId string, groupId string) (*Group, error) {
+	b, err := r.lockBoardFor(boardId, opGroupItems)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	dissolved, ok := b.Groups[groupId]
+	if !ok {
+		return nil, errors.New("group_not_found")
+	}
+
+	state := b.clone()
+	delete(state.Groups, groupId)
+	if err := r.updateGroups(b, state, groupId); err != nil {
+		return nil, err
+	}
+
+	// The items are still on the board to count their votes.
+	return groupView(b, dissolved), nil
+}
+
+// GroupItem moves an item into a group, out of the group it was in.
+func (r *memoryRepo) GroupItem(boardId string, groupId string, itemId string) (*Group, error) {
+	b, err := r.lockBoardFor(boardId, opGroupItems)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if _, ok := b.Groups[groupId]; !ok {
+		return nil, errors.New("group_not_found")
+	}
+	if _, err := r.getItem(b, itemId); err != nil {
+		return nil, err
+	}
+
+	state := b.clone()
+	group := state.Groups[groupId]
+	if group.itemIndex(itemId) >= 0 {
+		return groupView(b, group), nil
+	}
+
+	version := b.Version + 1
+	changed := []string{groupId}
+	if id := ungroupItem(&state, itemId, version); id != "" {
+		changed = append(changed, id)
+	}
+	group.Items = append(group.Items, itemId)
+	group.Version = version
+	if err := r.updateGroups(b, state, changed...); err != nil {
+		return nil, err
+	}
+
+	return groupView(b, group), nil
+}
+
+// UngroupItem takes an item out of a group.
+func (r *memoryRepo) UngroupItem(boardId string, groupId string, itemId string) (*Group, error) {
+	b, err := r.lockBoardFor(boardId, opGroupItems)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	group, ok := b.Groups[groupId]
+	if !ok {
+		return nil, errors.New("group_not_found")
+	}
+	if group.itemIndex(itemId) < 0 {
+		return nil, errors.New("item_not_found")
+	}
+
+	state := b.clone()
+	ungroupItem(&state, itemId, b.Version+1)
+	if err := r.updateGroups(b, state, groupId); err != nil {
+		return nil, err
+	}
+
+	return groupView(b, state.Groups[groupId]), nil
+}
+
+// ungroupItem takes an item out of its group, if it is in one, giving the
+// group the version. Returns the id of the group.
+func ungroupItem(state *BoardState, itemId string, version uint64) string {
+	g := state.groupOf(itemId)
+	if g == nil {
+		return ""
+	}
+	i := g.itemIndex(itemId)
+	g.Items = append(g.Items[:i], g.Items[i+1:]...)
+	g.Version = version
+	return g.Id
+}
+
+// updateGroups stores the board state, records the changed groups and
+// notifies the listeners.
+// Must be called while holding the board lock.
+func (r *memoryRepo) updateGroups(b *Board, state BoardState, groupIds ...string) error {
+	if err := r.store.UpdateBoard(b.Id, b.Version+1, &state); err != nil {
+		return err
+	}
+	b.BoardState = state
+
+	r.recordGroups(b, groupIds...)
+	r.commit(b)
+
+	return nil
+}
+
+// recordGroups records the groups changed with the upcoming version.
+// Must be called while holding the board lock.
+func (r *memoryRepo) recordGroups(b *Board, groupIds ...string) {
+	for _, id := range groupIds {
+		b.changes = append(b.changes, Change{Version: b.Version + 1, GroupId: id})
+	}
+}
+
+// groupView copies a group with the votes of its items added up.
+// Must be called while holding the board lock.
+func groupView(b *Board, g *Group) *Group {
+	view := g.clone()
+	for _, itemId := range g.Items {
+		it, ok := b.Items[itemId]
+		if !ok {
+			continue
+		}
+		for p, n := range it.Votes {
+			if view.Votes == nil {
+				view.Votes = make(map[string]int)
+			}
+			view.Votes[p] += n
+		}
+	}
+	return view
+}
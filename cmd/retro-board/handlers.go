@@ -1,36 +1,253 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// defaultPollTimeout is how long a long poll waits for changes by default.
+const defaultPollTimeout = 30 * time.Second
+
+// heartbeatInterval is how often a connected participant is kept online,
+// well within the presence timeout.
+const heartbeatInterval = 20 * time.Second
+
+// participantHeader holds the id of the participant making a request.
+// Clients which can't set headers, such as browsers opening a web socket
+// or an event source, use the participant_id query parameter instead.
+const participantHeader = "X-Participant-Id"
+
 type handler struct {
-	repo Repo
+	repo        Repo
+	pollTimeout time.Duration
+	// cursors relays the cursors of the socket clients.
+	cursors *cursorHub
 }
 
 type Handler interface {
 	healthCheck(w http.ResponseWriter, r *http.Request)
 	createBoard(w http.ResponseWriter, r *http.Request)
 	getBoard(w http.ResponseWriter, r *http.Request)
+	archiveBoard(w http.ResponseWriter, r *http.Request)
+	deleteBoard(w http.ResponseWriter, r *http.Request)
 	createItem(w http.ResponseWriter, r *http.Request)
 	updateItem(w http.ResponseWriter, r *http.Request)
+	patchItem(w http.ResponseWriter, r *http.Request)
+	deleteItem(w http.ResponseWriter, r *http.Request)
+	editText(w http.ResponseWriter, r *http.Request)
+	createColumn(w http.ResponseWriter, r *http.Request)
+	updateColumn(w http.ResponseWriter, r *http.Request)
+	moveColumn(w http.ResponseWriter, r *http.Request)
+	deleteColumn(w http.ResponseWriter, r *http.Request)
+	createGroup(w http.ResponseWriter, r *http.Request)
+	updateGroup(w http.ResponseWriter, r *http.Request)
+	dissolveGroup(w http.ResponseWriter, r *http.Request)
+	groupItem(w http.ResponseWriter, r *http.Request)
+	ungroupItem(w http.ResponseWriter, r *http.Request)
+	createAction(w http.ResponseWriter, r *http.Request)
+	updateAction(w http.ResponseWriter, r *http.Request)
+	deleteAction(w http.ResponseWriter, r *http.Request)
+	carryOverActions(w http.ResponseWriter, r *http.Request)
+	addComment(w http.ResponseWriter, r *http.Request)
+	editComment(w http.ResponseWriter, r *http.Request)
+	deleteComment(w http.ResponseWriter, r *http.Request)
+	toggleReaction(w http.ResponseWriter, r *http.Request)
+	join(w http.ResponseWriter, r *http.Request)
+	leave(w http.ResponseWriter, r *http.Request)
+	getParticipants(w http.ResponseWriter, r *http.Request)
 	getBoardUpdates(w http.ResponseWriter, r *http.Request)
+	boardSocket(w http.ResponseWriter, r *http.Request)
+	boardEvents(w http.ResponseWriter, r *http.Request)
+	addVote(w http.ResponseWriter, r *http.Request)
+	removeVote(w http.ResponseWriter, r *http.Request)
+	setVoteBudget(w http.ResponseWriter, r *http.Request)
+	getRanking(w http.ResponseWriter, r *http.Request)
+	setFacilitator(w http.ResponseWriter, r *http.Request)
+	setVisibility(w http.ResponseWriter, r *http.Request)
+	setPhase(w http.ResponseWriter, r *http.Request)
+	controlTimer(w http.ResponseWriter, r *http.Request)
+	getTemplates(w http.ResponseWriter, r *http.Request)
+	saveTemplate(w http.ResponseWriter, r *http.Request)
+	deleteTemplate(w http.ResponseWriter, r *http.Request)
+}
+
+// HandlerOption configures the handler.
+type HandlerOption func(h *handler)
+
+// WithPollTimeout sets how long a long poll waits for changes.
+func WithPollTimeout(d time.Duration) HandlerOption {
+	return func(h *handler) {
+		h.pollTimeout = d
+	}
 }
 
-func NewHandler(r Repo) Handler {
-	return &handler{repo: r}
+func NewHandler(r Repo, opts ...HandlerOption) Handler {
+	h := &handler{repo: r, pollTimeout: defaultPollTimeout, cursors: newCursorHub()}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
 }
 
 // writeError returns an error for the response.
+// A version conflict is returned with the current item.
 func writeError(w http.ResponseWriter, err error) {
-	w.WriteHeader(400)
+	res := ErrorResponse{Error: err.Error()}
+
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		res.Item = conflict.Item
+		w.Header().Set("ETag", itemETag(conflict.Item))
+	}
+
+	w.WriteHeader(errorStatus(err))
+	json.NewEncoder(w).Encode(res)
+}
+
+// writeItem returns an item with its version as the ETag.
+func writeItem(w http.ResponseWriter, item *Item) {
+	w.Header().Set("ETag", itemETag(item))
+
+	json.NewEncoder(w).Encode(item)
+}
+
+// itemETag is the entity tag of an item version.
+func itemETag(item *Item) string {
+	return fmt.Sprintf("\"%d\"", item.Version)
+}
+
+// ifMatchVersion parses the item version in the If-Match header.
+// Returns zero if there is no header or it matches any version.
+func ifMatchVersion(r *http.Request) (uint64, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+
+	tag = strings.Trim(strings.TrimPrefix(tag, "W/"), "\"")
+	version, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid_argument_if_match")
+	}
+	return version, nil
+}
+
+// participantId returns the id of the participant making the request.
+func participantId(r *http.Request) (string, error) {
+	id := strings.TrimSpace(r.Header.Get(participantHeader))
+	if id == "" {
+		id = strings.TrimSpace(r.URL.Query().Get("participant_id"))
+	}
+	if id == "" {
+		return "", errors.New("missing_participant")
+	}
+	return id, nil
+}
+
+// keepPresent sends heartbeats of the participant making the request to
+// a board until the returned function is called.
+func (h *handler) keepPresent(r *http.Request, boardId string) (stop func()) {
+	participant, err := participantId(r)
+	if err != nil {
+		// Anonymous listeners are not tracked.
+		return func() {}
+	}
+
+	beat := func() {
+		// Archived boards don't track presence.
+		err := h.repo.Heartbeat(boardId, participant)
+		if err != nil && !errors.Is(err, ErrBoardArchived) {
+			log.Printf("heartbeat failed: %s", err)
+		}
+	}
+	beat()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				beat()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// viewItem copies an item of a board as the participant making the request
+// may see it.
+func (h *handler) viewItem(r *http.Request, boardId string, item *Item) *Item {
+	viewer, _ := participantId(r)
+
+	b, err := h.repo.GetBoard(boardId)
+	if err != nil {
+		// The board is gone, there is no one to hide from.
+		return item
+	}
+	return itemView(b, item, viewer)
+}
+
+// viewGroup copies a group of a board as the participant making the request
+// may see it.
+func (h *handler) viewGroup(r *http.Request, boardId string, group *Group) *Group {
+	viewer, _ := participantId(r)
+
+	b, err := h.repo.GetBoard(boardId)
+	if err != nil {
+		// The board is gone, there is no one to hide from.
+		return group
+	}
+	return groupViewFor(b, group, viewer)
+}
+
+// viewError hides what the participant making the request may not see of
+// the item of a version conflict.
+func (h *handler) viewError(r *http.Request, boardId string, err error) error {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return &ConflictError{Item: h.viewItem(r, boardId, conflict.Item)}
+	}
+	return err
+}
 
-	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+// errorStatus returns the response status for an error.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrBoardArchived):
+		return http.StatusConflict
+	case errors.As(err, new(*ConflictError)):
+		return http.StatusConflict
+	case errors.Is(err, ErrVoteBudgetExceeded):
+		return http.StatusConflict
+	case errors.Is(err, ErrVotesHidden):
+		return http.StatusConflict
+	case errors.Is(err, ErrPhase):
+		return http.StatusConflict
+	case errors.Is(err, ErrNotFacilitator):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotAuthor):
+		return http.StatusForbidden
+	case errors.Is(err, ErrBoardDeleted):
+		return http.StatusGone
+	default:
+		return http.StatusBadRequest
+	}
 }
 
 // healthCheck returns a health check message
@@ -41,24 +258,104 @@ func (h *handler) healthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 // createBoard creates a new board and returns the newly created board.
+// The board is laid out with the template named in the body, if any.
+// The participant creating the board becomes its facilitator.
 func (h *handler) createBoard(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	req := BoardRequest{}
+
+	// The body is optional.
+	if r.Body != nil {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil && err != io.EOF {
+			writeError(w, errors.New("Parse error"))
+			return
+		}
+	}
+
+	// Check the board to carry the actions from before creating one.
+	if req.CarryOver != "" {
+		if _, err := h.repo.GetBoard(req.CarryOver); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	var b *Board
+	var err error
+	if req.Template != "" {
+		b, err = h.repo.CreateBoardFromTemplate(req.Template)
+	} else {
+		b, err = h.repo.CreateBoard()
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-	b := h.repo.CreateBoard()
+	if req.CarryOver != "" {
+		b, err = h.repo.CarryOverActions(b.Id, req.CarryOver)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	if participant, err := participantId(r); err == nil {
+		b, err = h.repo.SetFacilitator(b.Id, participant, participant)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
 	json.NewEncoder(w).Encode(b)
 }
 
-// getBoard returns a board with the specified id.
+// getBoard returns a board with the specified id, as the participant
+// making the request may see it.
 func (h *handler) getBoard(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	id := mux.Vars(r)["board-id"]
+	viewer, _ := participantId(r)
 
 	b, err := h.repo.GetBoard(id)
 	if err != nil {
 		writeError(w, err)
 		return
 	}
-	json.NewEncoder(w).Encode(b)
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// archiveBoard makes the board with the specified id read-only.
+// Returns the archived board.
+func (h *handler) archiveBoard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := mux.Vars(r)["board-id"]
+
+	viewer, _ := participantId(r)
+
+	b, err := h.repo.ArchiveBoard(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// deleteBoard deletes the board with the specified id.
+// Returns the deleted board.
+func (h *handler) deleteBoard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := mux.Vars(r)["board-id"]
+
+	viewer, _ := participantId(r)
+
+	b, err := h.repo.DeleteBoard(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(boardView(b, viewer))
 }
 
 // createItem creates a new item for the specified board using the item info in body.
@@ -78,56 +375,903 @@ func (h *handler) createItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The author is the participant making the request.
+	item.Author, _ = participantId(r)
+
 	retItem, err := h.repo.CreateItem(boardId, &item)
 	if err != nil {
 		writeError(w, err)
 		return
 	}
-	json.NewEncoder(w).Encode(retItem)
+	writeItem(w, h.viewItem(r, boardId, retItem))
 }
 
 // updateItem updates an item in specified board id and item id using item info in body.
+// The item version, given in the If-Match header or the body, must match
+// the stored version. Otherwise a conflict is returned with the stored item.
 func (h *handler) updateItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	boardId := mux.Vars(r)["board-id"]
 	itemId := mux.Vars(r)["item-id"]
 
 	item := Item{}
-	json.NewDecoder(r.Body).Decode(&item)
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if version != 0 {
+		item.Version = version
+	}
 
 	retItem, err := h.repo.UpdateItem(boardId, itemId, &item)
+	if err != nil {
+		writeError(w, h.viewError(r, boardId, err))
+		return
+	}
+	writeItem(w, h.viewItem(r, boardId, retItem))
+}
+
+// patchItem changes only the fields of an item which are in the body,
+// a JSON merge patch (RFC 7396). Fields set to null are cleared.
+// The item version, given in the If-Match header or the body, must match
+// the stored version. Otherwise a conflict is returned with the stored item.
+func (h *handler) patchItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil || !json.Valid(patch) {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	version, err := ifMatchVersion(r)
 	if err != nil {
 		writeError(w, err)
 		return
 	}
-	json.NewEncoder(w).Encode(retItem)
+	if version != 0 {
+		// The header takes precedence over a version in the patch.
+		changes := map[string]interface{}{}
+		if json.Unmarshal(patch, &changes) != nil {
+			writeError(w, errors.New("Parse error"))
+			return
+		}
+		changes["version"] = version
+		patch, _ = json.Marshal(changes)
+	}
+
+	retItem, err := h.repo.PatchItem(boardId, itemId, patch)
+	if err != nil {
+		writeError(w, h.viewError(r, boardId, err))
+		return
+	}
+	writeItem(w, h.viewItem(r, boardId, retItem))
 }
 
-// getBoardUpdates long polls for the changes in specified board id.
-// Returns a board object with changed items.
-// If no changes happen after an amount of time, returns the board object
-// with an empty items array.
-func (h *handler) getBoardUpdates(w http.ResponseWriter, r *http.Request) {
+// deleteItem deletes an item in specified board id and item id.
+// Returns the deleted item.
+func (h *handler) deleteItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	id := mux.Vars(r)["board-id"]
-	sVersion := mux.Vars(r)["version"]
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
 
-	// Parse version number.
-	version, err := strconv.ParseUint(sVersion, 10, 64)
+	retItem, err := h.repo.DeleteItem(boardId, itemId)
 	if err != nil {
-		writeError(w, errors.New("invalid_argument_version"))
+		writeError(w, err)
 		return
 	}
+	writeItem(w, h.viewItem(r, boardId, retItem))
+}
 
-	// Does the board exist?
-	b, err := h.repo.GetBoard(id)
+// editText merges the character operations in body into the text of an
+// item in specified board id and item id. Returns the updated item.
+func (h *handler) editText(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+
+	edit := TextEdit{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&edit)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retItem, err := h.repo.EditText(boardId, itemId, edit.Ops)
 	if err != nil {
 		writeError(w, err)
 		return
 	}
+	writeItem(w, h.viewItem(r, boardId, retItem))
+}
 
-	// Poll for changes on the board.
-	h.repo.GetBoardUpdates(b, version)
+// createColumn adds a new column to the end of the specified board using
+// the column info in body. Returns the created column.
+func (h *handler) createColumn(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	column := Column{}
 
-	json.NewEncoder(w).Encode(b)
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&column)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retColumn, err := h.repo.CreateColumn(boardId, &column)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retColumn)
+}
+
+// updateColumn renames a column in specified board id and column id using
+// the title and color in body. Returns the updated column.
+func (h *handler) updateColumn(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	columnId := mux.Vars(r)["column-id"]
+	column := Column{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&column)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retColumn, err := h.repo.UpdateColumn(boardId, columnId, &column)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retColumn)
+}
+
+// moveColumn moves a column in specified board id and column id to the
+// order in body. Returns the moved column.
+func (h *handler) moveColumn(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	columnId := mux.Vars(r)["column-id"]
+	column := Column{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&column)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retColumn, err := h.repo.MoveColumn(boardId, columnId, column.Order)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retColumn)
+}
+
+// deleteColumn deletes a column in specified board id and column id.
+// Returns the deleted column.
+func (h *handler) deleteColumn(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	columnId := mux.Vars(r)["column-id"]
+
+	retColumn, err := h.repo.DeleteColumn(boardId, columnId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retColumn)
+}
+
+// createGroup creates a new group in the specified board using the title,
+// items and bounding box in body. Returns the new group.
+func (h *handler) createGroup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	group := Group{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&group)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retGroup, err := h.repo.CreateGroup(boardId, &group)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(h.viewGroup(r, boardId, retGroup))
+}
+
+// updateGroup changes a group in specified board id and group id using
+// the title and bounding box in body. Returns the updated group.
+func (h *handler) updateGroup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	groupId := mux.Vars(r)["group-id"]
+	group := Group{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&group)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retGroup, err := h.repo.UpdateGroup(boardId, groupId, &group)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(h.viewGroup(r, boardId, retGroup))
+}
+
+// dissolveGroup deletes a group in specified board id and group id,
+// leaving its items. Returns the dissolved group.
+func (h *handler) dissolveGroup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	groupId := mux.Vars(r)["group-id"]
+
+	retGroup, err := h.repo.DissolveGroup(boardId, groupId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(h.viewGroup(r, boardId, retGroup))
+}
+
+// groupItem moves an item into a group in specified board id, group id and
+// item id. Returns the group.
+func (h *handler) groupItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	groupId := mux.Vars(r)["group-id"]
+	itemId := mux.Vars(r)["item-id"]
+
+	retGroup, err := h.repo.GroupItem(boardId, groupId, itemId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(h.viewGroup(r, boardId, retGroup))
+}
+
+// ungroupItem takes an item out of a group in specified board id, group id
+// and item id. Returns the group.
+func (h *handler) ungroupItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	groupId := mux.Vars(r)["group-id"]
+	itemId := mux.Vars(r)["item-id"]
+
+	retGroup, err := h.repo.UngroupItem(boardId, groupId, itemId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(h.viewGroup(r, boardId, retGroup))
+}
+
+// createAction creates a new action item in the specified board using the
+// title, assignee, due date, status and source item in body. Returns the
+// new action item.
+func (h *handler) createAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	action := Action{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&action)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retAction, err := h.repo.CreateAction(boardId, &action)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retAction)
+}
+
+// updateAction changes an action item in specified board id and action id
+// using the title, assignee, due date and status in body. Returns the
+// updated action item.
+func (h *handler) updateAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	actionId := mux.Vars(r)["action-id"]
+	action := Action{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&action)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retAction, err := h.repo.UpdateAction(boardId, actionId, &action)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retAction)
+}
+
+// deleteAction deletes an action item in specified board id and action id.
+// Returns the deleted action item.
+func (h *handler) deleteAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	actionId := mux.Vars(r)["action-id"]
+
+	retAction, err := h.repo.DeleteAction(boardId, actionId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retAction)
+}
+
+// carryOverActions copies the open action items of the board in body into
+// the specified board. Returns the board.
+func (h *handler) carryOverActions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	req := CarryOver{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	b, err := h.repo.CarryOverActions(boardId, req.BoardId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	viewer, _ := participantId(r)
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// addComment adds a comment of the participant with the text in body to
+// an item in specified board id and item id. Returns the new comment.
+func (h *handler) addComment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+	comment := Comment{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&comment)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+	comment.Author, _ = participantId(r)
+
+	retComment, err := h.repo.AddComment(boardId, itemId, &comment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retComment)
+}
+
+// editComment changes the text of a comment of the participant in
+// specified board id, item id and comment id to the text in body.
+// Returns the edited comment.
+func (h *handler) editComment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+	commentId := mux.Vars(r)["comment-id"]
+	comment := Comment{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&comment)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+	comment.Author, _ = participantId(r)
+
+	retComment, err := h.repo.EditComment(boardId, itemId, commentId, &comment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retComment)
+}
+
+// deleteComment deletes a comment of the participant in specified board id,
+// item id and comment id. Returns the deleted comment.
+func (h *handler) deleteComment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+	commentId := mux.Vars(r)["comment-id"]
+	participant, _ := participantId(r)
+
+	retComment, err := h.repo.DeleteComment(boardId, itemId, commentId, participant)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retComment)
+}
+
+// toggleReaction adds or takes back the reaction of the participant with
+// the emoji in body to an item in specified board id and item id.
+// Returns the item.
+func (h *handler) toggleReaction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+	req := ReactionRequest{}
+
+	participant, err := participantId(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	retItem, err := h.repo.ToggleReaction(boardId, itemId, participant, req.Emoji)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeItem(w, h.viewItem(r, boardId, retItem))
+}
+
+// join adds the participant making the request to the specified board with
+// the name and color in body, or changes them. Returns the participant.
+func (h *handler) join(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	participant := Participant{}
+
+	id, err := participantId(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&participant)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+	participant.Id = id
+
+	retParticipant, err := h.repo.Join(boardId, &participant)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retParticipant)
+}
+
+// leave makes the participant making the request offline on the specified
+// board. Returns the participant.
+func (h *handler) leave(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+
+	id, err := participantId(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	retParticipant, err := h.repo.Leave(boardId, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retParticipant)
+}
+
+// getParticipants returns the participants of the specified board by name,
+// online or not.
+func (h *handler) getParticipants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+
+	participants, err := h.repo.GetParticipants(boardId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(participants)
+}
+
+// addVote adds a vote of the participant to an item in specified board id
+// and item id. Returns the voted item.
+func (h *handler) addVote(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+
+	participant, err := participantId(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	retItem, err := h.repo.AddVote(boardId, itemId, participant)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeItem(w, h.viewItem(r, boardId, retItem))
+}
+
+// removeVote takes back a vote of the participant from an item in
+// specified board id and item id. Returns the item.
+func (h *handler) removeVote(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	itemId := mux.Vars(r)["item-id"]
+
+	participant, err := participantId(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	retItem, err := h.repo.RemoveVote(boardId, itemId, participant)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeItem(w, h.viewItem(r, boardId, retItem))
+}
+
+// setVoteBudget sets the vote budget of the specified board, or of a
+// participant of it, using the budget info in body. Returns the board.
+func (h *handler) setVoteBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	budget := VoteBudget{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&budget)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	viewer, _ := participantId(r)
+	b, err := h.repo.SetVoteBudget(boardId, viewer, budget)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// getRanking returns the items of the specified board, the most voted first.
+func (h *handler) getRanking(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+
+	items, err := h.repo.GetRanking(boardId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for i, it := range items {
+		items[i] = h.viewItem(r, boardId, it)
+	}
+	json.NewEncoder(w).Encode(items)
+}
+
+// getBoardUpdates long polls for the changes in specified board id.
+// Returns a board object with the items changed and the ids of the items
+// deleted after the given version, immediately if there are any.
+// If no changes happen after the poll timeout, returns the board object
+// with an empty items array. Gives up when the client goes away.
+// Returns a board_deleted error if the board is deleted meanwhile.
+func (h *handler) getBoardUpdates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := mux.Vars(r)["board-id"]
+	sVersion := mux.Vars(r)["version"]
+	viewer, _ := participantId(r)
+
+	// Parse version number.
+	version, err := strconv.ParseUint(sVersion, 10, 64)
+	if err != nil {
+		writeError(w, errors.New("invalid_argument_version"))
+		return
+	}
+
+	// Does the board exist?
+	b, err := h.repo.GetBoard(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// The participant is online while polling.
+	defer h.keepPresent(r, id)()
+
+	// Poll for changes on the board.
+	ctx, cancel := context.WithTimeout(r.Context(), h.pollTimeout)
+	defer cancel()
+
+	updates, err := h.repo.GetBoardUpdates(ctx, b, version)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Nothing changed in time. The board state comes as in any update,
+		// without the groups and action items which come as changes.
+		b.Mutex.Lock()
+		updates = &Board{Id: b.Id, Items: make(map[string]*Item), Version: version, BoardState: b.clone()}
+		b.Mutex.Unlock()
+		updates.Groups = nil
+		updates.Actions = nil
+	} else if errors.Is(err, ErrBoardDeleted) {
+		writeError(w, err)
+		return
+	} else if err != nil {
+		// The client is gone.
+		return
+	}
+
+	json.NewEncoder(w).Encode(viewBoard(updates, viewer))
+}
+
+// setFacilitator hands the facilitator role of the specified board over to
+// the participant in body. Returns the board.
+func (h *handler) setFacilitator(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	facilitator := Facilitator{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&facilitator)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	viewer, _ := participantId(r)
+	b, err := h.repo.SetFacilitator(boardId, viewer, facilitator.ParticipantId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// setVisibility sets what the participants of the specified board see of
+// each other's items and votes using the rules in body. Returns the board.
+func (h *handler) setVisibility(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	visibility := Visibility{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&visibility)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	viewer, _ := participantId(r)
+	b, err := h.repo.SetVisibility(boardId, viewer, visibility)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// setPhase moves the specified board to the phase in body, or the next
+// phase if there is no body. Returns the board.
+func (h *handler) setPhase(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	req := PhaseRequest{}
+
+	// The body is optional.
+	if r.Body != nil {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil && err != io.EOF {
+			writeError(w, errors.New("Parse error"))
+			return
+		}
+	}
+
+	viewer, _ := participantId(r)
+	b, err := h.repo.SetPhase(boardId, viewer, req.Phase)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// controlTimer runs the timer action in body on the timer of the
+// specified board. Returns the board.
+func (h *handler) controlTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	boardId := mux.Vars(r)["board-id"]
+	req := TimerRequest{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+
+	viewer, _ := participantId(r)
+	b, err := h.repo.ControlTimer(boardId, viewer, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(boardView(b, viewer))
+}
+
+// getTemplates returns the built-in and custom board templates.
+func (h *handler) getTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	templates, err := h.repo.GetTemplates()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(templates)
+}
+
+// saveTemplate registers a custom template with the specified name using
+// the template info in body. Returns the saved template.
+func (h *handler) saveTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["template-name"]
+	t := Template{}
+
+	if r.Body == nil {
+		writeError(w, errors.New("Missing input error"))
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		writeError(w, errors.New("Parse error"))
+		return
+	}
+	t.Name = name
+
+	retTemplate, err := h.repo.SaveTemplate(&t)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retTemplate)
+}
+
+// deleteTemplate deletes the custom template with the specified name.
+// Returns the deleted template.
+func (h *handler) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["template-name"]
+
+	retTemplate, err := h.repo.DeleteTemplate(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(retTemplate)
 }
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -53,6 +57,107 @@ func TestHandlerCreateBoard(t *testing.T) {
 	repo.AssertExpectations(t)
 }
 
+func TestHandlerCreateBoardFromTemplate(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		BoardState: BoardState{Columns: []Column{{Id: "column_id", Title: "Mad"}}},
+	}
+
+	repo.
+		On("CreateBoardFromTemplate", "mad-sad-glad").
+		Return(&Board{
+			Id:         "board_id",
+			Items:      make(map[string]*Item),
+			BoardState: BoardState{Columns: []Column{{Id: "column_id", Title: "Mad"}}},
+		}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board", strings.NewReader(`{"template": "mad-sad-glad"}`))
+	h := http.HandlerFunc(NewHandler(repo).createBoard)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateBoardCarryOver(t *testing.T) {
+	var repo = &RepoMock{}
+
+	actions := map[string]*Action{
+		"action_id": {Id: "action_id", Title: "Fix CI", Status: "open", CarriedFrom: "old_board_id"},
+	}
+	expected := &Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		Version:    1,
+		BoardState: BoardState{Actions: actions},
+	}
+
+	repo.On("GetBoard", "old_board_id").Return(&Board{Id: "old_board_id"}, nil).Once()
+	repo.On("CreateBoard").Return(&Board{Id: "board_id", Items: make(map[string]*Item)}, nil).Once()
+	repo.On("CarryOverActions", "board_id", "old_board_id").Return(&Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		Version:    1,
+		BoardState: BoardState{Actions: actions},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board", strings.NewReader(`{"carry_over": "old_board_id"}`))
+	h := http.HandlerFunc(NewHandler(repo).createBoard)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateBoardCarryOverNotFoundError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	expected := &ErrorResponse{
+		Error: "board_not_found",
+	}
+
+	repo.On("GetBoard", "old_board_id").Return(nilBoard, errors.New("board_not_found")).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board", strings.NewReader(`{"carry_over": "old_board_id"}`))
+	h := http.HandlerFunc(NewHandler(repo).createBoard)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateBoardTemplateNotFoundError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	expected := &ErrorResponse{
+		Error: "template_not_found",
+	}
+
+	repo.
+		On("CreateBoardFromTemplate", "unknown").
+		Return(nilBoard, errors.New("template_not_found")).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board", strings.NewReader(`{"template": "unknown"}`))
+	h := http.HandlerFunc(NewHandler(repo).createBoard)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
 func TestHandlerGetBoard(t *testing.T) {
 	var repo = &RepoMock{}
 
@@ -108,8 +213,136 @@ func TestHandlerGetBoardError(t *testing.T) {
 	repo.AssertExpectations(t)
 }
 
+func TestHandlerGetBoardHidden(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Board{
+		Id: "board_id",
+		Items: map[string]*Item{
+			"alice_item": {Id: "alice_item", Author: "alice", Hidden: true},
+			"bob_item":   {Id: "bob_item", Text: "bar", Author: "bob", Votes: map[string]int{"bob": 1}},
+		},
+		Version:    4,
+		BoardState: BoardState{Visibility: Visibility{HideCards: true, HideVotes: true}},
+	}
+
+	repo.
+		On("GetBoard", "board_id").
+		Return(&Board{
+			Id: "board_id",
+			Items: map[string]*Item{
+				"alice_item": {Id: "alice_item", Text: "foo", Author: "alice", Votes: map[string]int{"alice": 2}},
+				"bob_item":   {Id: "bob_item", Text: "bar", Author: "bob", Votes: map[string]int{"alice": 1, "bob": 1}},
+			},
+			Version:    4,
+			BoardState: BoardState{Visibility: Visibility{HideCards: true, HideVotes: true}},
+		}, nil).Once()
+
+	req, _ := http.NewRequest("GET", "/api/board/board_id", nil)
+	req.Header.Set("X-Participant-Id", "bob")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).getBoard)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerArchiveBoard(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		Version:    1,
+		BoardState: BoardState{Archived: true},
+	}
+
+	repo.
+		On("ArchiveBoard", "board_id").
+		Return(&Board{
+			Id:         "board_id",
+			Items:      make(map[string]*Item),
+			Version:    1,
+			BoardState: BoardState{Archived: true},
+		}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/archive", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).archiveBoard)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerDeleteBoard(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Board{
+		Id:      "board_id",
+		Items:   make(map[string]*Item),
+		Version: 0,
+	}
+
+	repo.
+		On("DeleteBoard", "board_id").
+		Return(&Board{
+			Id:      "board_id",
+			Items:   make(map[string]*Item),
+			Version: 0,
+		}, nil).Once()
+
+	req, _ := http.NewRequest("DELETE", "/api/board/board_id", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).deleteBoard)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateItemArchivedBoardError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilItem *Item
+
+	expected := &ErrorResponse{
+		Error: "board_archived",
+	}
+
+	repo.
+		On("CreateItem", "board_id", mock.Anything).
+		Return(nilItem, ErrBoardArchived).
+		Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item", strings.NewReader("{}"))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).createItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
 func TestHandlerCreateItem(t *testing.T) {
 	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
 
 	expected := &Item{
 		Id:     "item_id",
@@ -211,6 +444,7 @@ func TestHandlerCreateItemNotFoundBoardError(t *testing.T) {
 
 func TestHandlerUpdateItem(t *testing.T) {
 	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
 
 	expected := &Item{
 		Id:     "item_id",
@@ -252,10 +486,53 @@ func TestHandlerUpdateItem(t *testing.T) {
 	h.ServeHTTP(rr, req)
 
 	checkStatusOK(t, rr.Code)
+	assert.Equal(t, `"0"`, rr.Header().Get("ETag"))
 	checkResultJSON(t, expected, rr.Body.Bytes(), &Item{})
 	repo.AssertExpectations(t)
 }
 
+func TestHandlerUpdateItemConflict(t *testing.T) {
+	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
+	var nilItem *Item
+
+	expected := &ErrorResponse{
+		Error: "version_conflict",
+		Item: &Item{
+			Id:      "item_id",
+			Version: 5,
+			Text:    "This is a newer item",
+		},
+	}
+
+	// The If-Match header sets the version the update is based on.
+	repo.
+		On("UpdateItem", "board_id", "item_id", mock.MatchedBy(func(item *Item) bool {
+			return item.Version == 4
+		})).
+		Return(nilItem, &ConflictError{Item: &Item{
+			Id:      "item_id",
+			Version: 5,
+			Text:    "This is a newer item",
+		}}).
+		Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/item/item_id", strings.NewReader(`{"text": "foo"}`))
+	req.Header.Set("If-Match", `"4"`)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).updateItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, `"5"`, rr.Header().Get("ETag"))
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
 func TestHandlerUpdateItemNotFoundBoardError(t *testing.T) {
 	var repo = &RepoMock{}
 
@@ -282,49 +559,76 @@ func TestHandlerUpdateItemNotFoundBoardError(t *testing.T) {
 	repo.AssertExpectations(t)
 }
 
-func TestHandlerGetBoardUpdates(t *testing.T) {
+func TestHandlerUpdateItemParseError(t *testing.T) {
 	var repo = &RepoMock{}
 
-	expected := &Board{
-		Id:      "board_id",
-		Items:   make(map[string]*Item),
-		Version: 0,
+	expected := &ErrorResponse{
+		Error: "Parse error",
 	}
 
-	repo.On("GetBoard", "board_id").Return(&Board{
-		Id:      "board_id",
-		Items:   make(map[string]*Item),
-		Version: 0,
-	}, nil).Once()
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/item/item_id", strings.NewReader("invalid: json"))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).updateItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
 
-	repo.On("GetBoardUpdates", mock.Anything, mock.Anything).Return().Once()
+func TestHandlerPatchItem(t *testing.T) {
+	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
 
-	req, _ := http.NewRequest("GET", "/api/board/board_id/updates/0", nil)
+	expected := &Item{
+		Id:    "item_id",
+		Text:  "This is an item",
+		Color: "blue",
+		Left:  10,
+		Top:   20,
+	}
+
+	input := `{"left": 10, "top": 20}`
+
+	repo.On("PatchItem", "board_id", "item_id", []byte(input)).Return(&Item{
+		Id:    "item_id",
+		Text:  "This is an item",
+		Color: "blue",
+		Left:  10,
+		Top:   20,
+	}, nil).Once()
+
+	req, _ := http.NewRequest("PATCH", "/api/board/board_id/item/item_id", strings.NewReader(input))
 	req = mux.SetURLVars(req, map[string]string{
 		"board-id": "board_id",
-		"version":  "0",
+		"item-id":  "item_id",
 	})
-	h := http.HandlerFunc(NewHandler(repo).getBoardUpdates)
+	h := http.HandlerFunc(NewHandler(repo).patchItem)
 	rr := httptest.NewRecorder()
 	h.ServeHTTP(rr, req)
 
 	checkStatusOK(t, rr.Code)
-	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Item{})
 	repo.AssertExpectations(t)
 }
 
-func TestHandlerGetBoardUpdatesInputError(t *testing.T) {
+func TestHandlerPatchItemParseError(t *testing.T) {
 	var repo = &RepoMock{}
 
 	expected := &ErrorResponse{
-		Error: "invalid_argument_version",
+		Error: "Parse error",
 	}
 
-	req, _ := http.NewRequest("GET", "/api/board/board_id/updates/K0", nil)
+	req, _ := http.NewRequest("PATCH", "/api/board/board_id/item/item_id", strings.NewReader("invalid: json"))
 	req = mux.SetURLVars(req, map[string]string{
-		"version": "K0",
+		"board-id": "board_id",
+		"item-id":  "item_id",
 	})
-	h := http.HandlerFunc(NewHandler(repo).getBoardUpdates)
+	h := http.HandlerFunc(NewHandler(repo).patchItem)
 	rr := httptest.NewRecorder()
 	h.ServeHTTP(rr, req)
 
@@ -333,24 +637,56 @@ func TestHandlerGetBoardUpdatesInputError(t *testing.T) {
 	repo.AssertExpectations(t)
 }
 
-func TestHandlerGetBoardUpdatesNotFoundBoardError(t *testing.T) {
+func TestHandlerEditText(t *testing.T) {
 	var repo = &RepoMock{}
-	var nilBoard *Board
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
+
+	expected := &Item{
+		Id:   "item_id",
+		Text: "ax",
+	}
+
+	ops := []TextOp{
+		{Type: "insert", Id: TextId{Counter: 3, Site: "alice"}, After: TextId{Counter: 1}, Char: "x"},
+	}
+	input := `{"ops": [{"type": "insert", "id": {"counter": 3, "site": "alice"}, "after": {"counter": 1}, "char": "x"}]}`
+
+	repo.On("EditText", "board_id", "item_id", ops).Return(&Item{
+		Id:   "item_id",
+		Text: "ax",
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item/item_id/text", strings.NewReader(input))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).editText)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Item{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerEditTextInvalidOpError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilItem *Item
 
 	expected := &ErrorResponse{
-		Error: "board_not_found",
+		Error: "invalid_text_op",
 	}
 
-	repo.
-		On("GetBoard", "not_existing_board_id").
-		Return(nilBoard, errors.New("board_not_found")).Once()
+	repo.On("EditText", "board_id", "item_id", []TextOp{{Type: "replace"}}).
+		Return(nilItem, errors.New("invalid_text_op")).Once()
 
-	req, _ := http.NewRequest("GET", "/api/board/not_existing_board_id/updates/0", nil)
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item/item_id/text", strings.NewReader(`{"ops": [{"type": "replace"}]}`))
 	req = mux.SetURLVars(req, map[string]string{
-		"board-id": "not_existing_board_id",
-		"version":  "0",
+		"board-id": "board_id",
+		"item-id":  "item_id",
 	})
-	h := http.HandlerFunc(NewHandler(repo).getBoardUpdates)
+	h := http.HandlerFunc(NewHandler(repo).editText)
 	rr := httptest.NewRecorder()
 	h.ServeHTTP(rr, req)
 
@@ -358,3 +694,995 @@ func TestHandlerGetBoardUpdatesNotFoundBoardError(t *testing.T) {
 	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
 	repo.AssertExpectations(t)
 }
+
+func TestHandlerDeleteItem(t *testing.T) {
+	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
+
+	expected := &Item{
+		Id:   "item_id",
+		Text: "This is a deleted item",
+	}
+
+	repo.On("DeleteItem", "board_id", "item_id").Return(&Item{
+		Id:   "item_id",
+		Text: "This is a deleted item",
+	}, nil).Once()
+
+	req, _ := http.NewRequest("DELETE", "/api/board/board_id/item/item_id", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).deleteItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Item{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerDeleteItemNotFoundError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilItem *Item
+
+	expected := &ErrorResponse{
+		Error: "item_not_found",
+	}
+
+	repo.
+		On("DeleteItem", "board_id", "not_existing_item_id").
+		Return(nilItem, errors.New("item_not_found")).
+		Once()
+
+	req, _ := http.NewRequest("DELETE", "/api/board/board_id/item/not_existing_item_id", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "not_existing_item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).deleteItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetBoardUpdates(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Board{
+		Id: "board_id",
+		Items: map[string]*Item{
+			"item_id": {Id: "item_id", Text: "changed"},
+		},
+		Version: 2,
+	}
+
+	repo.On("GetBoard", "board_id").Return(&Board{
+		Id:      "board_id",
+		Items:   make(map[string]*Item),
+		Version: 0,
+	}, nil).Once()
+
+	repo.On("GetBoardUpdates", mock.Anything, mock.Anything, uint64(1)).Return(&Board{
+		Id: "board_id",
+		Items: map[string]*Item{
+			"item_id": {Id: "item_id", Text: "changed"},
+		},
+		Version: 2,
+	}, nil).Once()
+
+	req, _ := http.NewRequest("GET", "/api/board/board_id/updates/1", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"version":  "1",
+	})
+	h := http.HandlerFunc(NewHandler(repo).getBoardUpdates)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetBoardUpdatesTimeout(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	// The board state is kept on timeouts.
+	expected := &Board{
+		Id:      "board_id",
+		Items:   make(map[string]*Item),
+		Version: 3,
+		BoardState: BoardState{
+			Archived:    true,
+			Columns:     []Column{{Id: "column_id", Title: "Went well"}},
+			Phase:       "vote",
+			Facilitator: "alice",
+			Visibility:  Visibility{HideVotes: true},
+		},
+	}
+
+	repo.On("GetBoard", "board_id").Return(&Board{
+		Id:      "board_id",
+		Items:   make(map[string]*Item),
+		Version: 3,
+		BoardState: BoardState{
+			Archived:    true,
+			Columns:     []Column{{Id: "column_id", Title: "Went well"}},
+			Phase:       "vote",
+			Facilitator: "alice",
+			Visibility:  Visibility{HideVotes: true},
+			Groups:      map[string]*Group{"group_id": {Id: "group_id"}},
+		},
+	}, nil).Once()
+
+	repo.
+		On("GetBoardUpdates", mock.Anything, mock.Anything, uint64(3)).
+		Return(nilBoard, context.DeadlineExceeded).
+		Once()
+
+	req, _ := http.NewRequest("GET", "/api/board/board_id/updates/3", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"version":  "3",
+	})
+	h := http.HandlerFunc(NewHandler(repo, WithPollTimeout(time.Millisecond)).getBoardUpdates)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetBoardUpdatesDeletedBoardError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	expected := &ErrorResponse{
+		Error: "board_deleted",
+	}
+
+	repo.On("GetBoard", "board_id").Return(&Board{
+		Id:      "board_id",
+		Items:   make(map[string]*Item),
+		Version: 0,
+	}, nil).Once()
+
+	repo.
+		On("GetBoardUpdates", mock.Anything, mock.Anything, uint64(0)).
+		Return(nilBoard, ErrBoardDeleted).
+		Once()
+
+	req, _ := http.NewRequest("GET", "/api/board/board_id/updates/0", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"version":  "0",
+	})
+	h := http.HandlerFunc(NewHandler(repo).getBoardUpdates)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusGone, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetBoardUpdatesInputError(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &ErrorResponse{
+		Error: "invalid_argument_version",
+	}
+
+	req, _ := http.NewRequest("GET", "/api/board/board_id/updates/K0", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"version": "K0",
+	})
+	h := http.HandlerFunc(NewHandler(repo).getBoardUpdates)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetBoardUpdatesNotFoundBoardError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	expected := &ErrorResponse{
+		Error: "board_not_found",
+	}
+
+	repo.
+		On("GetBoard", "not_existing_board_id").
+		Return(nilBoard, errors.New("board_not_found")).Once()
+
+	req, _ := http.NewRequest("GET", "/api/board/not_existing_board_id/updates/0", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "not_existing_board_id",
+		"version":  "0",
+	})
+	h := http.HandlerFunc(NewHandler(repo).getBoardUpdates)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateGroup(t *testing.T) {
+	var repo = &RepoMock{}
+
+	// The group carries the votes of its items.
+	expected := &Group{
+		Version: 3,
+		Id:      "group_id",
+		Title:   "Tooling",
+		Items:   []string{"item_id"},
+		Width:   100,
+		Votes:   map[string]int{"alice": 2, "bob": 1},
+	}
+
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
+	repo.On("CreateGroup", "board_id", &Group{Title: "Tooling", Items: []string{"item_id"}, Width: 100}).Return(&Group{
+		Version: 3,
+		Id:      "group_id",
+		Title:   "Tooling",
+		Items:   []string{"item_id"},
+		Width:   100,
+		Votes:   map[string]int{"alice": 2, "bob": 1},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/group", strings.NewReader(`{"title": "Tooling", "items": ["item_id"], "width": 100}`))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).createGroup)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Group{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGroupItemHiddenVotes(t *testing.T) {
+	var repo = &RepoMock{}
+
+	// Only the viewer's own votes are in the group while votes are hidden.
+	expected := &Group{
+		Version: 4,
+		Id:      "group_id",
+		Items:   []string{"item_id"},
+		Votes:   map[string]int{"alice": 2},
+	}
+
+	repo.On("GetBoard", "board_id").Return(&Board{
+		Id:         "board_id",
+		BoardState: BoardState{Visibility: Visibility{HideVotes: true}},
+	}, nil)
+	repo.On("GroupItem", "board_id", "group_id", "item_id").Return(&Group{
+		Version: 4,
+		Id:      "group_id",
+		Items:   []string{"item_id"},
+		Votes:   map[string]int{"alice": 2, "bob": 1},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/group/group_id/item/item_id", nil)
+	req.Header.Set("X-Participant-Id", "alice")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"group-id": "group_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).groupItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Group{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGroupItemError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilGroup *Group
+
+	expected := &ErrorResponse{
+		Error: "group_not_found",
+	}
+
+	repo.On("GroupItem", "board_id", "group_id", "item_id").Return(nilGroup, errors.New("group_not_found")).Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/group/group_id/item/item_id", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"group-id": "group_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).groupItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateAction(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Action{
+		Version:  2,
+		Id:       "action_id",
+		Title:    "Fix CI",
+		Assignee: "alice",
+		DueDate:  "2020-01-31",
+		Status:   "open",
+		ItemId:   "item_id",
+	}
+
+	repo.On("CreateAction", "board_id", &Action{Title: "Fix CI", Assignee: "alice", DueDate: "2020-01-31", ItemId: "item_id"}).Return(&Action{
+		Version:  2,
+		Id:       "action_id",
+		Title:    "Fix CI",
+		Assignee: "alice",
+		DueDate:  "2020-01-31",
+		Status:   "open",
+		ItemId:   "item_id",
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/action", strings.NewReader(`{"title": "Fix CI", "assignee": "alice", "due_date": "2020-01-31", "item_id": "item_id"}`))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).createAction)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Action{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerAddComment(t *testing.T) {
+	var repo = &RepoMock{}
+	createdAt := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	expected := &Comment{
+		Id:        "comment_id",
+		Author:    "alice",
+		Text:      "Agreed",
+		CreatedAt: createdAt,
+	}
+
+	repo.On("AddComment", "board_id", "item_id", &Comment{Author: "alice", Text: "Agreed"}).Return(&Comment{
+		Id:        "comment_id",
+		Author:    "alice",
+		Text:      "Agreed",
+		CreatedAt: createdAt,
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item/item_id/comment", strings.NewReader(`{"text": "Agreed"}`))
+	req.Header.Set("X-Participant-Id", "alice")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).addComment)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Comment{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerDeleteCommentNotAuthorError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilComment *Comment
+
+	expected := &ErrorResponse{
+		Error: "not_author",
+	}
+
+	repo.On("DeleteComment", "board_id", "item_id", "comment_id", "bob").Return(nilComment, ErrNotAuthor).Once()
+
+	req, _ := http.NewRequest("DELETE", "/api/board/board_id/item/item_id/comment/comment_id", nil)
+	req.Header.Set("X-Participant-Id", "bob")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id":   "board_id",
+		"item-id":    "item_id",
+		"comment-id": "comment_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).deleteComment)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerToggleReaction(t *testing.T) {
+	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
+
+	// Who reacted is left out, the viewer's reactions are marked.
+	expected := &Item{
+		Id: "item_id",
+		Reactions: map[string]*Reaction{
+			"👍": {Count: 2, Me: true},
+			"🎉": {Count: 1},
+		},
+	}
+
+	repo.On("ToggleReaction", "board_id", "item_id", "participant_id", "👍").Return(&Item{
+		Id: "item_id",
+		Reactions: map[string]*Reaction{
+			"👍": {Count: 2, By: []string{"other_id", "participant_id"}},
+			"🎉": {Count: 1, By: []string{"other_id"}},
+		},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item/item_id/reaction", strings.NewReader(`{"emoji": "👍"}`))
+	req.Header.Set("X-Participant-Id", "participant_id")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).toggleReaction)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Item{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerJoin(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Participant{
+		Id:     "alice",
+		Name:   "Alice",
+		Color:  "#ff8800",
+		Online: true,
+	}
+
+	repo.On("Join", "board_id", &Participant{Id: "alice", Name: "Alice", Color: "#ff8800"}).Return(&Participant{
+		Id:     "alice",
+		Name:   "Alice",
+		Color:  "#ff8800",
+		Online: true,
+	}, nil).Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/participant", strings.NewReader(`{"name": "Alice", "color": "#ff8800"}`))
+	req.Header.Set("X-Participant-Id", "alice")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).join)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Participant{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerJoinMissingParticipantError(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &ErrorResponse{
+		Error: "missing_participant",
+	}
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/participant", strings.NewReader(`{"name": "Alice"}`))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).join)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetBoardUpdatesHeartbeat(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	repo.On("GetBoard", "board_id").Return(&Board{
+		Id:      "board_id",
+		Items:   make(map[string]*Item),
+		Version: 3,
+	}, nil).Once()
+
+	// The participant polling is kept online.
+	repo.On("Heartbeat", "board_id", "alice").Return(nil).Once()
+	repo.
+		On("GetBoardUpdates", mock.Anything, mock.Anything, uint64(3)).
+		Return(nilBoard, context.DeadlineExceeded).
+		Once()
+
+	req, _ := http.NewRequest("GET", "/api/board/board_id/updates/3", nil)
+	req.Header.Set("X-Participant-Id", "alice")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"version":  "3",
+	})
+	h := http.HandlerFunc(NewHandler(repo, WithPollTimeout(time.Millisecond)).getBoardUpdates)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateColumn(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Column{
+		Id:    "column_id",
+		Title: "Went well",
+		Color: "green",
+	}
+
+	repo.On("CreateColumn", "board_id", &Column{Title: "Went well", Color: "green"}).Return(&Column{
+		Id:    "column_id",
+		Title: "Went well",
+		Color: "green",
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/column", strings.NewReader(`{"title": "Went well", "color": "green"}`))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).createColumn)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Column{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerUpdateColumn(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Column{
+		Id:    "column_id",
+		Title: "To improve",
+		Color: "red",
+		Order: 1,
+	}
+
+	repo.On("UpdateColumn", "board_id", "column_id", &Column{Title: "To improve", Color: "red"}).Return(&Column{
+		Id:    "column_id",
+		Title: "To improve",
+		Color: "red",
+		Order: 1,
+	}, nil).Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/column/column_id", strings.NewReader(`{"title": "To improve", "color": "red"}`))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id":  "board_id",
+		"column-id": "column_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).updateColumn)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Column{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerMoveColumn(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Column{
+		Id:    "column_id",
+		Title: "Actions",
+		Order: 2,
+	}
+
+	repo.On("MoveColumn", "board_id", "column_id", 2).Return(&Column{
+		Id:    "column_id",
+		Title: "Actions",
+		Order: 2,
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/column/column_id/move", strings.NewReader(`{"order": 2}`))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id":  "board_id",
+		"column-id": "column_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).moveColumn)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Column{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerDeleteColumnNotFoundError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilColumn *Column
+
+	expected := &ErrorResponse{
+		Error: "column_not_found",
+	}
+
+	repo.On("DeleteColumn", "board_id", "column_id").Return(nilColumn, errors.New("column_not_found")).Once()
+
+	req, _ := http.NewRequest("DELETE", "/api/board/board_id/column/column_id", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id":  "board_id",
+		"column-id": "column_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).deleteColumn)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetTemplates(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &[]*Template{
+		{Name: "starfish", Title: "Starfish", BuiltIn: true, Columns: []Column{{Title: "Keep doing"}}},
+	}
+
+	repo.On("GetTemplates").Return([]*Template{
+		{Name: "starfish", Title: "Starfish", BuiltIn: true, Columns: []Column{{Title: "Keep doing"}}},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("GET", "/api/template", nil)
+	h := http.HandlerFunc(NewHandler(repo).getTemplates)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &[]*Template{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerSaveTemplate(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Template{
+		Name:    "team",
+		Title:   "Team retro",
+		Columns: []Column{{Title: "Went well", Color: "green"}},
+	}
+
+	repo.On("SaveTemplate", &Template{
+		Name:    "team",
+		Title:   "Team retro",
+		Columns: []Column{{Title: "Went well", Color: "green"}},
+	}).Return(&Template{
+		Name:    "team",
+		Title:   "Team retro",
+		Columns: []Column{{Title: "Went well", Color: "green"}},
+	}, nil).Once()
+
+	input := `{"name": "other", "title": "Team retro", "columns": [{"title": "Went well", "color": "green"}]}`
+	req, _ := http.NewRequest("PUT", "/api/template/team", strings.NewReader(input))
+	req = mux.SetURLVars(req, map[string]string{
+		"template-name": "team",
+	})
+	h := http.HandlerFunc(NewHandler(repo).saveTemplate)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Template{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerDeleteTemplateReadOnlyError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilTemplate *Template
+
+	expected := &ErrorResponse{
+		Error: "template_read_only",
+	}
+
+	repo.On("DeleteTemplate", "starfish").Return(nilTemplate, errors.New("template_read_only")).Once()
+
+	req, _ := http.NewRequest("DELETE", "/api/template/starfish", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"template-name": "starfish",
+	})
+	h := http.HandlerFunc(NewHandler(repo).deleteTemplate)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerAddVote(t *testing.T) {
+	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
+
+	expected := &Item{
+		Id:    "item_id",
+		Votes: map[string]int{"participant_id": 1},
+	}
+
+	repo.On("AddVote", "board_id", "item_id", "participant_id").Return(&Item{
+		Id:    "item_id",
+		Votes: map[string]int{"participant_id": 1},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item/item_id/vote", nil)
+	req.Header.Set("X-Participant-Id", "participant_id")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).addVote)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Item{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerAddVoteBudgetExceededError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilItem *Item
+
+	expected := &ErrorResponse{
+		Error: "vote_budget_exceeded",
+	}
+
+	repo.On("AddVote", "board_id", "item_id", "participant_id").Return(nilItem, ErrVoteBudgetExceeded).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item/item_id/vote", nil)
+	req.Header.Set("X-Participant-Id", "participant_id")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).addVote)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerRemoveVoteMissingParticipantError(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &ErrorResponse{
+		Error: "missing_participant",
+	}
+
+	req, _ := http.NewRequest("DELETE", "/api/board/board_id/item/item_id/vote", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+		"item-id":  "item_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).removeVote)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusNotOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerSetVoteBudget(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		Version:    1,
+		BoardState: BoardState{VoteBudgets: map[string]int{"participant_id": 3}},
+	}
+
+	repo.On("SetVoteBudget", "board_id", "alice", VoteBudget{ParticipantId: "participant_id", Budget: 3}).Return(&Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		Version:    1,
+		BoardState: BoardState{VoteBudgets: map[string]int{"participant_id": 3}},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/vote-budget", strings.NewReader(`{"participant_id": "participant_id", "budget": 3}`))
+	req.Header.Set("X-Participant-Id", "alice")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).setVoteBudget)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerSetVoteBudgetNotFacilitatorError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	expected := &ErrorResponse{
+		Error: "not_facilitator",
+	}
+
+	repo.On("SetVoteBudget", "board_id", "bob", VoteBudget{Budget: 10}).Return(nilBoard, ErrNotFacilitator).Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/vote-budget", strings.NewReader(`{"budget": 10}`))
+	req.Header.Set("X-Participant-Id", "bob")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).setVoteBudget)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetRanking(t *testing.T) {
+	var repo = &RepoMock{}
+	repo.On("GetBoard", "board_id").Return(&Board{Id: "board_id"}, nil)
+
+	expected := &[]*Item{
+		{Id: "first_id", Votes: map[string]int{"participant_id": 2}},
+		{Id: "second_id"},
+	}
+
+	repo.On("GetRanking", "board_id").Return([]*Item{
+		{Id: "first_id", Votes: map[string]int{"participant_id": 2}},
+		{Id: "second_id"},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("GET", "/api/board/board_id/ranking", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).getRanking)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &[]*Item{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerSetVisibilityNotFacilitatorError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilBoard *Board
+
+	expected := &ErrorResponse{
+		Error: "not_facilitator",
+	}
+
+	repo.On("SetVisibility", "board_id", "bob", Visibility{HideCards: true}).Return(nilBoard, ErrNotFacilitator).Once()
+
+	req, _ := http.NewRequest("PUT", "/api/board/board_id/visibility", strings.NewReader(`{"hide_cards": true}`))
+	req.Header.Set("X-Participant-Id", "bob")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).setVisibility)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerSetPhase(t *testing.T) {
+	var repo = &RepoMock{}
+
+	expected := &Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		Version:    2,
+		BoardState: BoardState{Facilitator: "alice", Phase: "brainstorm"},
+	}
+
+	repo.On("SetPhase", "board_id", "alice", "").Return(&Board{
+		Id:         "board_id",
+		Items:      make(map[string]*Item),
+		Version:    2,
+		BoardState: BoardState{Facilitator: "alice", Phase: "brainstorm"},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/phase", nil)
+	req.Header.Set("X-Participant-Id", "alice")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).setPhase)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &Board{})
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerControlTimer(t *testing.T) {
+	var repo = &RepoMock{}
+	endsAt := time.Date(2020, 1, 1, 10, 5, 0, 0, time.UTC)
+
+	repo.On("ControlTimer", "board_id", "alice", &TimerRequest{Action: "start", Duration: 300}).Return(&Board{
+		Id:      "board_id",
+		Items:   make(map[string]*Item),
+		Version: 2,
+		BoardState: BoardState{
+			Facilitator: "alice",
+			Timer:       &Timer{Duration: 300, EndsAt: &endsAt, Running: true},
+		},
+	}, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/timer", strings.NewReader(`{"action": "start", "duration": 300}`))
+	req.Header.Set("X-Participant-Id", "alice")
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).controlTimer)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	checkStatusOK(t, rr.Code)
+	b := &Board{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), b))
+	assert.Equal(t, &Timer{Duration: 300, EndsAt: &endsAt, Running: true}, b.Timer)
+	// The server time lets clients tell their clock drift.
+	assert.NotNil(t, b.ServerTime)
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateItemPhaseError(t *testing.T) {
+	var repo = &RepoMock{}
+	var nilItem *Item
+
+	expected := &ErrorResponse{
+		Error: "not_allowed_in_phase",
+	}
+
+	repo.On("CreateItem", "board_id", &Item{Text: "foo"}).Return(nilItem, ErrPhase).Once()
+
+	req, _ := http.NewRequest("POST", "/api/board/board_id/item", strings.NewReader(`{"text": "foo"}`))
+	req = mux.SetURLVars(req, map[string]string{
+		"board-id": "board_id",
+	})
+	h := http.HandlerFunc(NewHandler(repo).createItem)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	checkResultJSON(t, expected, rr.Body.Bytes(), &ErrorResponse{})
+	repo.AssertExpectations(t)
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -188,6 +191,285 @@ func TestUpdateItem(t *testing.T) {
 	assert.Equal(t, updatedId, itemId)
 }
 
+func TestUpdateItemConflict(t *testing.T) {
+	// First, create a board with an item.
+	req, err := http.NewRequest("POST", "/api/board", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := setupRouter()
+	rr := callHandler(router, req)
+
+	var created Board
+	err = json.Unmarshal(rr.Body.Bytes(), &created)
+	if err != nil {
+		t.Errorf("unable to parse response: %s", err)
+	}
+	boardId := created.Id
+
+	body := strings.NewReader(`{"text": "foo"}`)
+	req, err = http.NewRequest("POST", fmt.Sprintf("/api/board/%s/item", boardId), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = callHandler(router, req)
+
+	var item Item
+	err = json.Unmarshal(rr.Body.Bytes(), &item)
+	if err != nil {
+		t.Errorf("unable to parse response: %s", err)
+	}
+
+	checkStatusOK(t, rr.Code)
+	etag := rr.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	// Two clients update the item based on the same version.
+	for i, text := range []string{"bar", "baz"} {
+		body = strings.NewReader(fmt.Sprintf(`{"text": "%s"}`, text))
+		req, err = http.NewRequest("PATCH", fmt.Sprintf("/api/board/%s/item/%s", boardId, item.Id), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-Match", etag)
+
+		rr = callHandler(router, req)
+
+		if i == 0 {
+			checkStatusOK(t, rr.Code)
+			assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+			continue
+		}
+
+		// The second one gets the current item back.
+		var conflict ErrorResponse
+		err = json.Unmarshal(rr.Body.Bytes(), &conflict)
+		if err != nil {
+			t.Errorf("unable to parse response: %s", err)
+		}
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, "version_conflict", conflict.Error)
+		assert.Equal(t, "bar", conflict.Item.Text)
+		assert.EqualValues(t, 2, conflict.Item.Version)
+	}
+}
+
+func TestGetBoardUpdates(t *testing.T) {
+	// First, create a board.
+	req, err := http.NewRequest("POST", "/api/board", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := setupRouter()
+	rr := callHandler(router, req)
+
+	var created Board
+	err = json.Unmarshal(rr.Body.Bytes(), &created)
+	if err != nil {
+		t.Errorf("unable to parse response: %s", err)
+	}
+
+	checkStatusOK(t, rr.Code)
+	boardId := created.Id
+
+	// Create two items on the board.
+	var items []Item
+	for _, text := range []string{"foo", "bar"} {
+		body := strings.NewReader(fmt.Sprintf(`{"text": "%s"}`, text))
+		req, err = http.NewRequest("POST", fmt.Sprintf("/api/board/%s/item", boardId), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr = callHandler(router, req)
+
+		var item Item
+		err = json.Unmarshal(rr.Body.Bytes(), &item)
+		if err != nil {
+			t.Errorf("unable to parse response: %s", err)
+		}
+
+		checkStatusOK(t, rr.Code)
+		items = append(items, item)
+	}
+
+	// Poll for the changes after the first item.
+	req, err = http.NewRequest("GET", fmt.Sprintf("/api/board/%s/updates/1", boardId), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = callHandler(router, req)
+
+	var updates Board
+	err = json.Unmarshal(rr.Body.Bytes(), &updates)
+	if err != nil {
+		t.Errorf("unable to parse response: %s", err)
+	}
+
+	checkStatusOK(t, rr.Code)
+	assert.EqualValues(t, 2, updates.Version)
+	assert.Len(t, updates.Items, 1)
+	assert.Contains(t, updates.Items, items[1].Id)
+}
+
+func TestBoardSocket(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	// First, create a board.
+	res, err := http.Post(server.URL+"/api/board", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created Board
+	err = json.NewDecoder(res.Body).Decode(&created)
+	res.Body.Close()
+	if err != nil {
+		t.Errorf("unable to parse response: %s", err)
+	}
+
+	// Connect to the board socket.
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + fmt.Sprintf("/api/board/%s/ws", created.Id)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The whole board is sent first.
+	var msg SocketMessage
+	err = conn.ReadJSON(&msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "board", msg.Type)
+	assert.Equal(t, created.Id, msg.Board.Id)
+
+	// Create an item over the socket.
+	err = conn.WriteJSON(SocketMessage{Type: "create_item", Item: &Item{Text: "foo"}})
+	assert.NoError(t, err)
+
+	// Both the reply and the board update arrive, in any order.
+	received := map[string]SocketMessage{}
+	for i := 0; i < 2; i++ {
+		msg = SocketMessage{}
+		err = conn.ReadJSON(&msg)
+		assert.NoError(t, err)
+		received[msg.Type] = msg
+	}
+
+	item := received["item"].Item
+	assert.Equal(t, "foo", item.Text)
+	assert.EqualValues(t, 1, received["board"].Board.Version)
+	assert.Contains(t, received["board"].Board.Items, item.Id)
+
+	// Update the item over the socket.
+	err = conn.WriteJSON(SocketMessage{Type: "update_item", Id: item.Id, Item: &Item{Text: "bar"}})
+	assert.NoError(t, err)
+
+	received = map[string]SocketMessage{}
+	for i := 0; i < 2; i++ {
+		msg = SocketMessage{}
+		err = conn.ReadJSON(&msg)
+		assert.NoError(t, err)
+		received[msg.Type] = msg
+	}
+
+	assert.Equal(t, "bar", received["item"].Item.Text)
+	assert.Equal(t, "bar", received["board"].Board.Items[item.Id].Text)
+
+	// Errors are reported without closing the socket.
+	err = conn.WriteJSON(SocketMessage{Type: "update_item", Id: "not_existing_item_id", Item: &Item{}})
+	assert.NoError(t, err)
+
+	msg = SocketMessage{}
+	err = conn.ReadJSON(&msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "error", msg.Type)
+	assert.Equal(t, "item_not_found", msg.Error)
+
+	// A message over the read limit closes the socket.
+	err = conn.WriteJSON(SocketMessage{Type: "create_item", Item: &Item{Text: strings.Repeat("a", socketReadLimit)}})
+	assert.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	err = conn.ReadJSON(&msg)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "unexpected error: %v", err)
+}
+
+func TestBoardEvents(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	// First, create a board with three items.
+	res, err := http.Post(server.URL+"/api/board", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created Board
+	err = json.NewDecoder(res.Body).Decode(&created)
+	res.Body.Close()
+	if err != nil {
+		t.Errorf("unable to parse response: %s", err)
+	}
+
+	itemsURL := fmt.Sprintf("%s/api/board/%s/item", server.URL, created.Id)
+	var items []Item
+	for _, text := range []string{"foo", "bar", "baz"} {
+		res, err = http.Post(itemsURL, "application/json", strings.NewReader(fmt.Sprintf(`{"text": "%s"}`, text)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var item Item
+		err = json.NewDecoder(res.Body).Decode(&item)
+		res.Body.Close()
+		if err != nil {
+			t.Errorf("unable to parse response: %s", err)
+		}
+		items = append(items, item)
+	}
+
+	// Resume the stream after the first item.
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/board/%s/events", server.URL, created.Id), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "1")
+
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	checkStatusOK(t, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	events := bufio.NewReader(res.Body)
+	id, updates := readEvent(t, events)
+	assert.Equal(t, "3", id)
+	assert.Len(t, updates.Items, 2)
+	assert.Contains(t, updates.Items, items[1].Id)
+	assert.Contains(t, updates.Items, items[2].Id)
+
+	// New changes are pushed as they happen.
+	res, err = http.Post(itemsURL, "application/json", strings.NewReader(`{"text": "qux"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	id, updates = readEvent(t, events)
+	assert.Equal(t, "4", id)
+	assert.Len(t, updates.Items, 1)
+}
+
 // Helpers
 ////////////
 
@@ -198,6 +480,32 @@ func callHandler(router *mux.Router, req *http.Request) *httptest.ResponseRecord
 	return rr
 }
 
+// readEvent reads a server-sent board event.
+func readEvent(t *testing.T, r *bufio.Reader) (string, *Board) {
+	var id string
+	var b Board
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return id, &b
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &b)
+			if err != nil {
+				t.Errorf("unable to parse event: %s", err)
+			}
+		}
+	}
+}
+
 func setupRouter() *mux.Router {
 	repo := NewMemoryRepo()
 
@@ -206,3 +514,161 @@ func setupRouter() *mux.Router {
 
 	return r
 }
+
+func TestHiddenCards(t *testing.T) {
+	router := setupRouter()
+
+	// The participant creating the board facilitates it.
+	req, _ := http.NewRequest("POST", "/api/board", nil)
+	req.Header.Set("X-Participant-Id", "alice")
+	rr := callHandler(router, req)
+
+	var created Board
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	checkStatusOK(t, rr.Code)
+	assert.Equal(t, "alice", created.Facilitator)
+	boardId := created.Id
+
+	// Only the facilitator hides the cards.
+	for _, participant := range []string{"bob", "alice"} {
+		body := strings.NewReader(`{"hide_cards": true, "hide_votes": true}`)
+		req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/board/%s/visibility", boardId), body)
+		req.Header.Set("X-Participant-Id", participant)
+		rr = callHandler(router, req)
+	}
+	checkStatusOK(t, rr.Code)
+
+	items := make(map[string]Item)
+	for _, participant := range []string{"alice", "bob"} {
+		body := strings.NewReader(fmt.Sprintf(`{"text": "%s's card", "author": "carol"}`, participant))
+		req, _ = http.NewRequest("POST", fmt.Sprintf("/api/board/%s/item", boardId), body)
+		req.Header.Set("X-Participant-Id", participant)
+		rr = callHandler(router, req)
+
+		var item Item
+		json.Unmarshal(rr.Body.Bytes(), &item)
+		checkStatusOK(t, rr.Code)
+		assert.Equal(t, participant, item.Author)
+		items[participant] = item
+
+		req, _ = http.NewRequest("POST", fmt.Sprintf("/api/board/%s/item/%s/vote", boardId, item.Id), nil)
+		req.Header.Set("X-Participant-Id", participant)
+		rr = callHandler(router, req)
+		checkStatusOK(t, rr.Code)
+	}
+
+	// Bob sees his own card and votes only.
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/board/%s?participant_id=bob", boardId), nil)
+	rr = callHandler(router, req)
+
+	var board Board
+	json.Unmarshal(rr.Body.Bytes(), &board)
+	checkStatusOK(t, rr.Code)
+	assert.Equal(t, "bob's card", board.Items[items["bob"].Id].Text)
+	assert.Equal(t, map[string]int{"bob": 1}, board.Items[items["bob"].Id].Votes)
+	assert.Equal(t, "", board.Items[items["alice"].Id].Text)
+	assert.True(t, board.Items[items["alice"].Id].Hidden)
+	assert.Nil(t, board.Items[items["alice"].Id].Votes)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/board/%s/ranking", boardId), nil)
+	rr = callHandler(router, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// Revealing the cards sends the whole board to the listeners.
+	version := board.Version
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/board/%s/visibility", boardId), strings.NewReader(`{}`))
+	req.Header.Set("X-Participant-Id", "alice")
+	rr = callHandler(router, req)
+	checkStatusOK(t, rr.Code)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/board/%s/updates/%d", boardId, version), nil)
+	req.Header.Set("X-Participant-Id", "bob")
+	rr = callHandler(router, req)
+
+	var updates Board
+	json.Unmarshal(rr.Body.Bytes(), &updates)
+	checkStatusOK(t, rr.Code)
+	assert.True(t, updates.Full)
+	assert.Equal(t, "alice's card", updates.Items[items["alice"].Id].Text)
+	assert.Equal(t, map[string]int{"alice": 1}, updates.Items[items["alice"].Id].Votes)
+}
+
+func TestBoardSocketCursors(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/api/board", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created Board
+	json.NewDecoder(res.Body).Decode(&created)
+	res.Body.Close()
+
+	// Connect two participants to the board socket.
+	dial := func(participant string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") +
+			fmt.Sprintf("/api/board/%s/ws?participant_id=%s", created.Id, participant)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The whole board comes once the socket gets the cursors.
+		var msg SocketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	alice := dial("alice")
+	defer alice.Close()
+	bob := dial("bob")
+	defer bob.Close()
+
+	// readCursor skips the board messages until a cursor arrives.
+	readCursor := func(conn *websocket.Conn) *Cursor {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg SocketMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == "cursor" {
+				return msg.Cursor
+			}
+		}
+	}
+
+	// The cursor comes from the participant of the socket.
+	err = alice.WriteJSON(SocketMessage{Type: "cursor", Cursor: &Cursor{ParticipantId: "bob", X: 10, Y: 20, ItemId: "item_id", Left: 5, Top: 15}})
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{ParticipantId: "alice", X: 10, Y: 20, ItemId: "item_id", Left: 5, Top: 15}, readCursor(bob))
+
+	// Of the cursors sent too fast, the last one comes after the interval.
+	for i := 1; i <= 10; i++ {
+		alice.WriteJSON(SocketMessage{Type: "cursor", Cursor: &Cursor{X: float32(i)}})
+	}
+	received := 0
+	for {
+		cursor := readCursor(bob)
+		received++
+		if cursor.X == 10 {
+			break
+		}
+	}
+	assert.Less(t, received, 10)
+
+	// Cursors don't change the board.
+	res, err = http.Get(server.URL + "/api/board/" + created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var board Board
+	json.NewDecoder(res.Body).Decode(&board)
+	res.Body.Close()
+	assert.Empty(t, board.Items)
+	assert.Len(t, board.Participants, 2)
+	// The versions are the presence changes only.
+	assert.EqualValues(t, 2, board.Version)
+}
@@ -1,27 +1,126 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// shutdownTimeout is how long the running requests may take to finish
+// when the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	repo := NewMemoryRepo()
-	handler := NewHandler(repo)
+	pollTimeout := flag.Duration("poll-timeout", defaultPollTimeout, "long poll timeout")
+	store := flag.String("store", "memory", "board store: memory, sqlite, bolt or log")
+	db := flag.String("db", "retro-board.db", "database file of the store")
+	compactEvery := flag.Duration("compact-every", 10*time.Minute, "event log compaction interval")
+	flag.Parse()
+
+	repo, err := openRepo(*store, *db, *compactEvery)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler := NewHandler(repo, WithPollTimeout(*pollTimeout))
 	router := mux.NewRouter()
 	mapHandlerFuncs(router, handler)
+	server := &http.Server{Addr: ":8080", Handler: router}
+
+	// Stop on a signal, so that the repo is closed.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Println("Running server")
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		repo.Close()
+		log.Fatal(err)
+	case <-ctx.Done():
+		log.Println("Stopping server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown failed: %s", err)
+		}
+	}
+
+	if err := repo.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	log.Println("Running server")
-	log.Fatal(http.ListenAndServe(":8080", router))
+// openRepo opens the repo of the given store kind.
+func openRepo(store string, path string, compactEvery time.Duration) (Repo, error) {
+	switch store {
+	case "memory":
+		return NewMemoryRepo(), nil
+	case "sqlite":
+		return NewSQLiteRepo(path)
+	case "bolt":
+		return NewBoltRepo(path)
+	case "log":
+		return NewEventLogRepo(path, compactEvery)
+	default:
+		return nil, fmt.Errorf("unknown store: %s", store)
+	}
 }
 
 func mapHandlerFuncs(r *mux.Router, handler Handler) {
 	r.HandleFunc("/api", handler.healthCheck).Methods("GET")
 	r.HandleFunc("/api/board", handler.createBoard).Methods("POST")
 	r.HandleFunc("/api/board/{board-id}", handler.getBoard).Methods("GET")
+	r.HandleFunc("/api/board/{board-id}", handler.deleteBoard).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/archive", handler.archiveBoard).Methods("POST")
 	r.HandleFunc("/api/board/{board-id}/item", handler.createItem).Methods("POST")
 	r.HandleFunc("/api/board/{board-id}/item/{item-id}", handler.updateItem).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}", handler.patchItem).Methods("PATCH")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}", handler.deleteItem).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}/text", handler.editText).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}/comment", handler.addComment).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}/comment/{comment-id}", handler.editComment).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}/comment/{comment-id}", handler.deleteComment).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}/reaction", handler.toggleReaction).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}/vote", handler.addVote).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/item/{item-id}/vote", handler.removeVote).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/vote-budget", handler.setVoteBudget).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/ranking", handler.getRanking).Methods("GET")
+	r.HandleFunc("/api/board/{board-id}/facilitator", handler.setFacilitator).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/visibility", handler.setVisibility).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/phase", handler.setPhase).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/timer", handler.controlTimer).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/column", handler.createColumn).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/column/{column-id}", handler.updateColumn).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/column/{column-id}", handler.deleteColumn).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/column/{column-id}/move", handler.moveColumn).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/group", handler.createGroup).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/group/{group-id}", handler.updateGroup).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/group/{group-id}", handler.dissolveGroup).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/group/{group-id}/item/{item-id}", handler.groupItem).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/group/{group-id}/item/{item-id}", handler.ungroupItem).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/action", handler.createAction).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/action/{action-id}", handler.updateAction).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/action/{action-id}", handler.deleteAction).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/carry-over", handler.carryOverActions).Methods("POST")
+	r.HandleFunc("/api/board/{board-id}/participant", handler.join).Methods("PUT")
+	r.HandleFunc("/api/board/{board-id}/participant", handler.leave).Methods("DELETE")
+	r.HandleFunc("/api/board/{board-id}/participants", handler.getParticipants).Methods("GET")
 	r.HandleFunc("/api/board/{board-id}/updates/{version}", handler.getBoardUpdates).Methods("GET")
+	r.HandleFunc("/api/board/{board-id}/ws", handler.boardSocket).Methods("GET")
+	r.HandleFunc("/api/board/{board-id}/events", handler.boardEvents).Methods("GET")
+	r.HandleFunc("/api/template", handler.getTemplates).Methods("GET")
+	r.HandleFunc("/api/template/{template-name}", handler.saveTemplate).Methods("PUT")
+	r.HandleFunc("/api/template/{template-name}", handler.deleteTemplate).Methods("DELETE")
 }
@@ -1,16 +1,20 @@
 package main
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	"context"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 type RepoMock struct {
 	mock.Mock
 }
 
 // CreateBoard provides a mock function with given fields:
-func (_m *RepoMock) CreateBoard() *Board {
+func (_m *RepoMock) CreateBoard() (*Board, error) {
 	ret := _m.Called()
 
-	return ret.Get(0).(*Board)
+	return ret.Get(0).(*Board), ret.Error(1)
 }
 
 // CreateItem provides a mock function with given fields: boardId, item
@@ -20,6 +24,13 @@ func (_m *RepoMock) CreateItem(boardId string, item *Item) (*Item, error) {
 	return ret.Get(0).(*Item), ret.Error(1)
 }
 
+// CreateBoardFromTemplate provides a mock function with given fields: name
+func (_m *RepoMock) CreateBoardFromTemplate(name string) (*Board, error) {
+	ret := _m.Called(name)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
 // GetBoard provides a mock function with given fields: id
 func (_m *RepoMock) GetBoard(id string) (*Board, error) {
 	ret := _m.Called(id)
@@ -27,9 +38,11 @@ func (_m *RepoMock) GetBoard(id string) (*Board, error) {
 	return ret.Get(0).(*Board), ret.Error(1)
 }
 
-// GetBoardUpdates provides a mock function with given fields: b, version
-func (_m *RepoMock) GetBoardUpdates(b *Board, version uint64) {
-	_m.Called(b, version)
+// GetBoardUpdates provides a mock function with given fields: ctx, b, version
+func (_m *RepoMock) GetBoardUpdates(ctx context.Context, b *Board, version uint64) (*Board, error) {
+	ret := _m.Called(ctx, b, version)
+
+	return ret.Get(0).(*Board), ret.Error(1)
 }
 
 // GetItem provides a mock function with given fields: b, itemId
@@ -40,8 +53,10 @@ func (_m *RepoMock) GetItem(b *Board, itemId string) (*Item, error) {
 }
 
 // UpdateBoard provides a mock function with given fields: b, it
-func (_m *RepoMock) UpdateBoard(b *Board, it *Item) {
-	_m.Called(b, it)
+func (_m *RepoMock) UpdateBoard(b *Board, it *Item) error {
+	ret := _m.Called(b, it)
+
+	return ret.Error(0)
 }
 
 // UpdateItem provides a mock function with given fields: boardId, itemId, item
@@ -50,3 +65,269 @@ func (_m *RepoMock) UpdateItem(boardId string, itemId string, item *Item) (*Item
 
 	return ret.Get(0).(*Item), ret.Error(1)
 }
+
+// PatchItem provides a mock function with given fields: boardId, itemId, patch
+func (_m *RepoMock) PatchItem(boardId string, itemId string, patch []byte) (*Item, error) {
+	ret := _m.Called(boardId, itemId, patch)
+
+	return ret.Get(0).(*Item), ret.Error(1)
+}
+
+// EditText provides a mock function with given fields: boardId, itemId, ops
+func (_m *RepoMock) EditText(boardId string, itemId string, ops []TextOp) (*Item, error) {
+	ret := _m.Called(boardId, itemId, ops)
+
+	return ret.Get(0).(*Item), ret.Error(1)
+}
+
+// CreateGroup provides a mock function with given fields: boardId, group
+func (_m *RepoMock) CreateGroup(boardId string, group *Group) (*Group, error) {
+	ret := _m.Called(boardId, group)
+
+	return ret.Get(0).(*Group), ret.Error(1)
+}
+
+// UpdateGroup provides a mock function with given fields: boardId, groupId, group
+func (_m *RepoMock) UpdateGroup(boardId string, groupId string, group *Group) (*Group, error) {
+	ret := _m.Called(boardId, groupId, group)
+
+	return ret.Get(0).(*Group), ret.Error(1)
+}
+
+// DissolveGroup provides a mock function with given fields: boardId, groupId
+func (_m *RepoMock) DissolveGroup(boardId string, groupId string) (*Group, error) {
+	ret := _m.Called(boardId, groupId)
+
+	return ret.Get(0).(*Group), ret.Error(1)
+}
+
+// GroupItem provides a mock function with given fields: boardId, groupId, itemId
+func (_m *RepoMock) GroupItem(boardId string, groupId string, itemId string) (*Group, error) {
+	ret := _m.Called(boardId, groupId, itemId)
+
+	return ret.Get(0).(*Group), ret.Error(1)
+}
+
+// UngroupItem provides a mock function with given fields: boardId, groupId, itemId
+func (_m *RepoMock) UngroupItem(boardId string, groupId string, itemId string) (*Group, error) {
+	ret := _m.Called(boardId, groupId, itemId)
+
+	return ret.Get(0).(*Group), ret.Error(1)
+}
+
+// CreateAction provides a mock function with given fields: boardId, action
+func (_m *RepoMock) CreateAction(boardId string, action *Action) (*Action, error) {
+	ret := _m.Called(boardId, action)
+
+	return ret.Get(0).(*Action), ret.Error(1)
+}
+
+// UpdateAction provides a mock function with given fields: boardId, actionId, action
+func (_m *RepoMock) UpdateAction(boardId string, actionId string, action *Action) (*Action, error) {
+	ret := _m.Called(boardId, actionId, action)
+
+	return ret.Get(0).(*Action), ret.Error(1)
+}
+
+// DeleteAction provides a mock function with given fields: boardId, actionId
+func (_m *RepoMock) DeleteAction(boardId string, actionId string) (*Action, error) {
+	ret := _m.Called(boardId, actionId)
+
+	return ret.Get(0).(*Action), ret.Error(1)
+}
+
+// CarryOverActions provides a mock function with given fields: boardId, fromBoardId
+func (_m *RepoMock) CarryOverActions(boardId string, fromBoardId string) (*Board, error) {
+	ret := _m.Called(boardId, fromBoardId)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// AddComment provides a mock function with given fields: boardId, itemId, comment
+func (_m *RepoMock) AddComment(boardId string, itemId string, comment *Comment) (*Comment, error) {
+	ret := _m.Called(boardId, itemId, comment)
+
+	return ret.Get(0).(*Comment), ret.Error(1)
+}
+
+// EditComment provides a mock function with given fields: boardId, itemId, commentId, comment
+func (_m *RepoMock) EditComment(boardId string, itemId string, commentId string, comment *Comment) (*Comment, error) {
+	ret := _m.Called(boardId, itemId, commentId, comment)
+
+	return ret.Get(0).(*Comment), ret.Error(1)
+}
+
+// DeleteComment provides a mock function with given fields: boardId, itemId, commentId, participantId
+func (_m *RepoMock) DeleteComment(boardId string, itemId string, commentId string, participantId string) (*Comment, error) {
+	ret := _m.Called(boardId, itemId, commentId, participantId)
+
+	return ret.Get(0).(*Comment), ret.Error(1)
+}
+
+// ToggleReaction provides a mock function with given fields: boardId, itemId, participantId, emoji
+func (_m *RepoMock) ToggleReaction(boardId string, itemId string, participantId string, emoji string) (*Item, error) {
+	ret := _m.Called(boardId, itemId, participantId, emoji)
+
+	return ret.Get(0).(*Item), ret.Error(1)
+}
+
+// Join provides a mock function with given fields: boardId, participant
+func (_m *RepoMock) Join(boardId string, participant *Participant) (*Participant, error) {
+	ret := _m.Called(boardId, participant)
+
+	return ret.Get(0).(*Participant), ret.Error(1)
+}
+
+// Leave provides a mock function with given fields: boardId, participantId
+func (_m *RepoMock) Leave(boardId string, participantId string) (*Participant, error) {
+	ret := _m.Called(boardId, participantId)
+
+	return ret.Get(0).(*Participant), ret.Error(1)
+}
+
+// Heartbeat provides a mock function with given fields: boardId, participantId
+func (_m *RepoMock) Heartbeat(boardId string, participantId string) error {
+	ret := _m.Called(boardId, participantId)
+
+	return ret.Error(0)
+}
+
+// GetParticipants provides a mock function with given fields: boardId
+func (_m *RepoMock) GetParticipants(boardId string) ([]*Participant, error) {
+	ret := _m.Called(boardId)
+
+	return ret.Get(0).([]*Participant), ret.Error(1)
+}
+
+// CreateColumn provides a mock function with given fields: boardId, column
+func (_m *RepoMock) CreateColumn(boardId string, column *Column) (*Column, error) {
+	ret := _m.Called(boardId, column)
+
+	return ret.Get(0).(*Column), ret.Error(1)
+}
+
+// UpdateColumn provides a mock function with given fields: boardId, columnId, column
+func (_m *RepoMock) UpdateColumn(boardId string, columnId string, column *Column) (*Column, error) {
+	ret := _m.Called(boardId, columnId, column)
+
+	return ret.Get(0).(*Column), ret.Error(1)
+}
+
+// MoveColumn provides a mock function with given fields: boardId, columnId, order
+func (_m *RepoMock) MoveColumn(boardId string, columnId string, order int) (*Column, error) {
+	ret := _m.Called(boardId, columnId, order)
+
+	return ret.Get(0).(*Column), ret.Error(1)
+}
+
+// DeleteColumn provides a mock function with given fields: boardId, columnId
+func (_m *RepoMock) DeleteColumn(boardId string, columnId string) (*Column, error) {
+	ret := _m.Called(boardId, columnId)
+
+	return ret.Get(0).(*Column), ret.Error(1)
+}
+
+// DeleteItem provides a mock function with given fields: boardId, itemId
+func (_m *RepoMock) DeleteItem(boardId string, itemId string) (*Item, error) {
+	ret := _m.Called(boardId, itemId)
+
+	return ret.Get(0).(*Item), ret.Error(1)
+}
+
+// ArchiveBoard provides a mock function with given fields: id
+func (_m *RepoMock) ArchiveBoard(id string) (*Board, error) {
+	ret := _m.Called(id)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// DeleteBoard provides a mock function with given fields: id
+func (_m *RepoMock) DeleteBoard(id string) (*Board, error) {
+	ret := _m.Called(id)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// Close provides a mock function with given fields:
+func (_m *RepoMock) Close() error {
+	ret := _m.Called()
+
+	return ret.Error(0)
+}
+
+// AddVote provides a mock function with given fields: boardId, itemId, participantId
+func (_m *RepoMock) AddVote(boardId string, itemId string, participantId string) (*Item, error) {
+	ret := _m.Called(boardId, itemId, participantId)
+
+	return ret.Get(0).(*Item), ret.Error(1)
+}
+
+// RemoveVote provides a mock function with given fields: boardId, itemId, participantId
+func (_m *RepoMock) RemoveVote(boardId string, itemId string, participantId string) (*Item, error) {
+	ret := _m.Called(boardId, itemId, participantId)
+
+	return ret.Get(0).(*Item), ret.Error(1)
+}
+
+// SetVoteBudget provides a mock function with given fields: boardId, participantId, budget
+func (_m *RepoMock) SetVoteBudget(boardId string, participantId string, budget VoteBudget) (*Board, error) {
+	ret := _m.Called(boardId, participantId, budget)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// GetRanking provides a mock function with given fields: boardId
+func (_m *RepoMock) GetRanking(boardId string) ([]*Item, error) {
+	ret := _m.Called(boardId)
+
+	return ret.Get(0).([]*Item), ret.Error(1)
+}
+
+// SetFacilitator provides a mock function with given fields: boardId, participantId, facilitatorId
+func (_m *RepoMock) SetFacilitator(boardId string, participantId string, facilitatorId string) (*Board, error) {
+	ret := _m.Called(boardId, participantId, facilitatorId)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// SetVisibility provides a mock function with given fields: boardId, participantId, visibility
+func (_m *RepoMock) SetVisibility(boardId string, participantId string, visibility Visibility) (*Board, error) {
+	ret := _m.Called(boardId, participantId, visibility)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// SetPhase provides a mock function with given fields: boardId, participantId, phase
+func (_m *RepoMock) SetPhase(boardId string, participantId string, phase string) (*Board, error) {
+	ret := _m.Called(boardId, participantId, phase)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// ControlTimer provides a mock function with given fields: boardId, participantId, req
+func (_m *RepoMock) ControlTimer(boardId string, participantId string, req *TimerRequest) (*Board, error) {
+	ret := _m.Called(boardId, participantId, req)
+
+	return ret.Get(0).(*Board), ret.Error(1)
+}
+
+// GetTemplates provides a mock function with given fields:
+func (_m *RepoMock) GetTemplates() ([]*Template, error) {
+	ret := _m.Called()
+
+	return ret.Get(0).([]*Template), ret.Error(1)
+}
+
+// SaveTemplate provides a mock function with given fields: t
+func (_m *RepoMock) SaveTemplate(t *Template) (*Template, error) {
+	ret := _m.Called(t)
+
+	return ret.Get(0).(*Template), ret.Error(1)
+}
+
+// DeleteTemplate provides a mock function with given fields: name
+func (_m *RepoMock) DeleteTemplate(name string) (*Template, error) {
+	ret := _m.Called(name)
+
+	return ret.Get(0).(*Template), ret.Error(1)
+}
@@ -0,0 +1,25 @@
+package main
+
+// mergePatch applies a JSON merge patch (RFC 7396) to a decoded JSON value
+// and returns the result. Members set to null in the patch are removed.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		// Anything but an object replaces the target.
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
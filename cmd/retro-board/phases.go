@@ -0,0 +1,86 @@
+package main
+
+import "errors"
+
+// Board phases, in the order a retro runs through them.
+const (
+	phaseSetup      = "setup"
+	phaseBrainstorm = "brainstorm"
+	phaseGroup      = "group"
+	phaseVote       = "vote"
+	phaseDiscuss    = "discuss"
+	phaseActions    = "actions"
+	phaseClosed     = "closed"
+)
+
+// phases lists the board phases in order.
+var phases = []string{
+	phaseSetup,
+	phaseBrainstorm,
+	phaseGroup,
+	phaseVote,
+	phaseDiscuss,
+	phaseActions,
+	phaseClosed,
+}
+
+// Operations which depend on the board phase.
+const (
+	opEditColumns = "edit_columns"
+	opCreateItem  = "create_item"
+	opEditItem    = "edit_item"
+	opVote        = "vote"
+	opGroupItems  = "group_items"
+	opEditActions = "edit_actions"
+	opComment     = "comment"
+	opReact       = "react"
+)
+
+// phaseOps are the operations allowed in each phase.
+var phaseOps = map[string][]string{
+	phaseSetup:      {opEditColumns, opEditActions},
+	phaseBrainstorm: {opEditColumns, opCreateItem, opEditItem, opGroupItems, opComment, opReact},
+	phaseGroup:      {opEditItem, opGroupItems, opComment, opReact},
+	phaseVote:       {opVote, opReact},
+	phaseDiscuss:    {opEditActions, opComment, opReact},
+	phaseActions:    {opEditActions, opComment, opReact},
+	phaseClosed:     {},
+}
+
+// ErrPhase is returned on an operation the board phase doesn't allow.
+var ErrPhase = errors.New("not_allowed_in_phase")
+
+// nextPhase returns the phase after the given one. A board without
+// a phase starts with the first one.
+func nextPhase(phase string) (string, error) {
+	if phase == "" {
+		return phases[0], nil
+	}
+	for i, p := range phases {
+		if p == phase && i+1 < len(phases) {
+			return phases[i+1], nil
+		}
+	}
+	return "", errors.New("invalid_phase")
+}
+
+// validPhase tells whether the phase is known.
+func validPhase(phase string) bool {
+	_, ok := phaseOps[phase]
+	return ok
+}
+
+// checkPhase checks that the board phase allows an operation.
+// Boards without a phase allow everything.
+// Must be called while holding the board lock.
+func checkPhase(b *Board, op string) error {
+	if b.Phase == "" {
+		return nil
+	}
+	for _, allowed := range phaseOps[b.Phase] {
+		if allowed == op {
+			return nil
+		}
+	}
+	return ErrPhase
+}
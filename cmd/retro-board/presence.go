@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// defaultPresenceTimeout is how long a participant stays online after the
+// last heartbeat.
+const defaultPresenceTimeout = time.Minute
+
+// heartbeat is the last sign of life of a participant on a board.
+type heartbeat struct {
+	at     time.Time
+	expiry *time.Timer
+}
+
+// Join adds a participant to a board with a display name and an avatar
+// color, or changes them, and makes the participant online. Archived
+// boards don't track presence.
+func (r *memoryRepo) Join(boardId string, participant *Participant) (*Participant, error) {
+	if participant.Id == "" {
+		return nil, errors.New("input_error")
+	}
+
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	joined := *participant
+	joined.Online = true
+
+	state := b.clone()
+	if state.Participants == nil {
+		state.Participants = make(map[string]*Participant)
+	}
+	state.Participants[joined.Id] = &joined
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+	r.schedulePresence(b, joined.Id)
+
+	ret := joined
+	return &ret, nil
+}
+
+// Leave makes a participant of a board offline.
+func (r *memoryRepo) Leave(boardId string, participantId string) (*Participant, error) {
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	p, ok := b.Participants[participantId]
+	if !ok {
+		return nil, errors.New("participant_not_found")
+	}
+
+	if hb, ok := b.heartbeats[participantId]; ok {
+		hb.expiry.Stop()
+		delete(b.heartbeats, participantId)
+	}
+	if p.Online {
+		r.setOnline(b, participantId, false)
+	}
+
+	ret := *b.Participants[participantId]
+	return &ret, nil
+}
+
+// Heartbeat keeps a participant of a board online. Participants who
+// haven't joined are added without a name.
+func (r *memoryRepo) Heartbeat(boardId string, participantId string) error {
+	if participantId == "" {
+		return errors.New("input_error")
+	}
+
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return err
+	}
+	defer b.Mutex.Unlock()
+
+	// Only coming online is a change, the heartbeats themselves are not.
+	if p, ok := b.Participants[participantId]; !ok || !p.Online {
+		r.setOnline(b, participantId, true)
+	}
+	r.schedulePresence(b, participantId)
+
+	return nil
+}
+
+// GetParticipants returns copies of the participants of a board by name.
+func (r *memoryRepo) GetParticipants(boardId string) ([]*Participant, error) {
+	b, err := r.lockBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	participants := make([]*Participant, 0, len(b.Participants))
+	for _, p := range b.Participants {
+		c := *p
+		participants = append(participants, &c)
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		pi, pj := participants[i], participants[j]
+		if pi.Name != pj.Name {
+			return pi.Name < pj.Name
+		}
+		return pi.Id < pj.Id
+	})
+
+	return participants, nil
+}
+
+// setOnline changes whether a participant is online and notifies the
+// listeners. Presence is not stored, so nothing is written.
+// Must be called while holding the board lock.
+func (r *memoryRepo) setOnline(b *Board, participantId string, online bool) {
+	state := b.clone()
+	if state.Participants == nil {
+		state.Participants = make(map[string]*Participant)
+	}
+	p, ok := state.Participants[participantId]
+	if !ok {
+		p = &Participant{Id: participantId}
+		state.Participants[participantId] = p
+	}
+	p.Online = online
+	b.BoardState = state
+
+	// Notify listeners.
+	r.commit(b)
+}
+
+// schedulePresence makes a participant go offline if no heartbeat comes
+// in time.
+// Must be called while holding the board lock.
+func (r *memoryRepo) schedulePresence(b *Board, participantId string) {
+	if hb, ok := b.heartbeats[participantId]; ok {
+		hb.expiry.Stop()
+	}
+	if b.heartbeats == nil {
+		b.heartbeats = make(map[string]*heartbeat)
+	}
+
+	at := time.Now()
+	b.heartbeats[participantId] = &heartbeat{
+		at: at,
+		expiry: time.AfterFunc(r.presenceTimeout, func() {
+			r.expirePresence(b, participantId, at)
+		}),
+	}
+}
+
+// expirePresence makes a participant offline if there was no heartbeat
+// since the given one.
+func (r *memoryRepo) expirePresence(b *Board, participantId string, at time.Time) {
+	// The registry lock keeps the repo from closing meanwhile.
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.closed {
+		return
+	}
+
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+
+	hb, ok := b.heartbeats[participantId]
+	if b.deleted || b.Archived || !ok || !hb.at.Equal(at) {
+		return
+	}
+	delete(b.heartbeats, participantId)
+
+	r.setOnline(b, participantId, false)
+}
+
+// stopTimers stops the timer and the presence expiries of a board.
+// Must be called while holding the board lock.
+func (b *Board) stopTimers() {
+	if b.expiry != nil {
+		b.expiry.Stop()
+	}
+	for _, hb := range b.heartbeats {
+		hb.expiry.Stop()
+	}
+}
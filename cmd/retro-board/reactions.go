@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxEmojiLen is the longest emoji in bytes, long enough for sequences
+// like flags and skin tones.
+const maxEmojiLen = 32
+
+// ToggleReaction adds the reaction of a participant with an emoji to an
+// item, or takes it back if the participant has reacted with it already.
+func (r *memoryRepo) ToggleReaction(boardId string, itemId string, participantId string, emoji string) (*Item, error) {
+	if participantId == "" {
+		return nil, errors.New("input_error")
+	}
+	if err := checkEmoji(emoji); err != nil {
+		return nil, err
+	}
+
+	b, err := r.lockBoardFor(boardId, opReact)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *oItem.clone()
+	if updated.Reactions == nil {
+		updated.Reactions = make(map[string]*Reaction)
+	}
+	reaction, ok := updated.Reactions[emoji]
+	if !ok {
+		reaction = &Reaction{}
+		updated.Reactions[emoji] = reaction
+	}
+	if i := indexOf(reaction.By, participantId); i >= 0 {
+		reaction.By = append(reaction.By[:i], reaction.By[i+1:]...)
+	} else {
+		reaction.By = append(reaction.By, participantId)
+	}
+	reaction.Count = len(reaction.By)
+	if reaction.Count == 0 {
+		delete(updated.Reactions, emoji)
+	}
+
+	return r.replaceItem(b, oItem, updated)
+}
+
+// checkEmoji checks that an emoji is short and has no plain text in it,
+// i.e. ASCII characters, letters or spaces.
+func checkEmoji(emoji string) error {
+	if emoji == "" || len(emoji) > maxEmojiLen || !utf8.ValidString(emoji) {
+		return errors.New("invalid_emoji")
+	}
+	for _, c := range emoji {
+		if c < utf8.RuneSelf || unicode.IsLetter(c) || unicode.IsSpace(c) {
+			return errors.New("invalid_emoji")
+		}
+	}
+	return nil
+}
+
+// indexOf finds the position of a string in a list, -1 if it is not there.
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// redactReactions marks the reactions of the viewer and leaves out who
+// reacted.
+func redactReactions(reactions map[string]*Reaction, viewer string) {
+	for _, reaction := range reactions {
+		reaction.Me = viewer != "" && indexOf(reaction.By, viewer) >= 0
+		reaction.By = nil
+	}
+}
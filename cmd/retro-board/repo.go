@@ -1,97 +1,743 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"log"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 // Repo interface.
 type Repo interface {
-	CreateBoard() *Board
+	CreateBoard() (*Board, error)
+	CreateBoardFromTemplate(name string) (*Board, error)
 	GetBoard(id string) (*Board, error)
-	UpdateBoard(b *Board, it *Item)
-	GetBoardUpdates(b *Board, version uint64)
+	UpdateBoard(b *Board, it *Item) error
+	GetBoardUpdates(ctx context.Context, b *Board, version uint64) (*Board, error)
 	CreateItem(boardId string, item *Item) (*Item, error)
 	GetItem(b *Board, itemId string) (*Item, error)
 	UpdateItem(boardId string, itemId string, item *Item) (*Item, error)
+	PatchItem(boardId string, itemId string, patch []byte) (*Item, error)
+	DeleteItem(boardId string, itemId string) (*Item, error)
+	EditText(boardId string, itemId string, ops []TextOp) (*Item, error)
+	CreateColumn(boardId string, column *Column) (*Column, error)
+	UpdateColumn(boardId string, columnId string, column *Column) (*Column, error)
+	MoveColumn(boardId string, columnId string, order int) (*Column, error)
+	DeleteColumn(boardId string, columnId string) (*Column, error)
+	AddVote(boardId string, itemId string, participantId string) (*Item, error)
+	RemoveVote(boardId string, itemId string, participantId string) (*Item, error)
+	SetVoteBudget(boardId string, participantId string, budget VoteBudget) (*Board, error)
+	GetRanking(boardId string) ([]*Item, error)
+	SetFacilitator(boardId string, participantId string, facilitatorId string) (*Board, error)
+	SetVisibility(boardId string, participantId string, visibility Visibility) (*Board, error)
+	SetPhase(boardId string, participantId string, phase string) (*Board, error)
+	ControlTimer(boardId string, participantId string, req *TimerRequest) (*Board, error)
+	CreateGroup(boardId string, group *Group) (*Group, error)
+	UpdateGroup(boardId string, groupId string, group *Group) (*Group, error)
+	DissolveGroup(boardId string, groupId string) (*Group, error)
+	GroupItem(boardId string, groupId string, itemId string) (*Group, error)
+	UngroupItem(boardId string, groupId string, itemId string) (*Group, error)
+	CreateAction(boardId string, action *Action) (*Action, error)
+	UpdateAction(boardId string, actionId string, action *Action) (*Action, error)
+	DeleteAction(boardId string, actionId string) (*Action, error)
+	CarryOverActions(boardId string, fromBoardId string) (*Board, error)
+	AddComment(boardId string, itemId string, comment *Comment) (*Comment, error)
+	EditComment(boardId string, itemId string, commentId string, comment *Comment) (*Comment, error)
+	DeleteComment(boardId string, itemId string, commentId string, participantId string) (*Comment, error)
+	ToggleReaction(boardId string, itemId string, participantId string, emoji string) (*Item, error)
+	Join(boardId string, participant *Participant) (*Participant, error)
+	Leave(boardId string, participantId string) (*Participant, error)
+	Heartbeat(boardId string, participantId string) error
+	GetParticipants(boardId string) ([]*Participant, error)
+	ArchiveBoard(id string) (*Board, error)
+	DeleteBoard(id string) (*Board, error)
+	GetTemplates() ([]*Template, error)
+	SaveTemplate(t *Template) (*Template, error)
+	DeleteTemplate(name string) (*Template, error)
+	Close() error
 }
 
+// ConflictError is returned when an item is updated based on an older
+// version than the stored one.
+type ConflictError struct {
+	// Item is the stored item.
+	Item *Item
+}
+
+func (e *ConflictError) Error() string {
+	return "version_conflict"
+}
+
+var (
+	// ErrBoardArchived is returned on changes to an archived board.
+	ErrBoardArchived = errors.New("board_archived")
+	// ErrBoardDeleted is returned to the listeners of a deleted board.
+	ErrBoardDeleted = errors.New("board_deleted")
+	// ErrVoteBudgetExceeded is returned when a participant has no votes left.
+	ErrVoteBudgetExceeded = errors.New("vote_budget_exceeded")
+	// ErrNotFacilitator is returned when a participant other than the
+	// facilitator runs the board.
+	ErrNotFacilitator = errors.New("not_facilitator")
+	// ErrVotesHidden is returned when the votes are asked for while hidden.
+	ErrVotesHidden = errors.New("votes_hidden")
+	// ErrNotAuthor is returned when a participant changes the comment of
+	// another.
+	ErrNotAuthor = errors.New("not_author")
+)
+
+// maxChanges is how long the change log of a board grows before the older
+// half of it is dropped.
+const maxChanges = 1000
+
 // memoryRepo is an in-memory data store.
+// The boards and templates maps are guarded by the repo mutex, the contents
+// of a board by the board mutex. Changes are written through to the store.
 type memoryRepo struct {
-	boards map[string]*Board
+	mutex     sync.RWMutex
+	boards    map[string]*Board
+	templates map[string]*Template
+	store     Store
+
+	// done stops the background work on close.
+	done chan struct{}
+	wg   sync.WaitGroup
+	// closed is set on close, guarded by the repo mutex.
+	closed bool
+	// presenceTimeout is how long participants stay online after their
+	// last heartbeat.
+	presenceTimeout time.Duration
 }
 
 // NewMemoryRepo initializes the repo.
 func NewMemoryRepo() Repo {
 	r := memoryRepo{}
 	r.boards = make(map[string]*Board)
+	r.templates = make(map[string]*Template)
+	r.store = nopStore{}
+	r.done = make(chan struct{})
+	r.presenceTimeout = defaultPresenceTimeout
 
 	return &r
 }
 
-// CreateBoard creates a new board.
-func (r *memoryRepo) CreateBoard() *Board {
-	id := uuid.New().String()
+// newStoreRepo initializes the repo with the boards in the store.
+func newStoreRepo(s Store) (*memoryRepo, error) {
+	boards, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := s.LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &memoryRepo{
+		boards:    make(map[string]*Board),
+		templates: make(map[string]*Template),
+		store:     s,
+		done:      make(chan struct{}),
+
+		presenceTimeout: defaultPresenceTimeout,
+	}
+	for _, b := range boards {
+		// The earlier changes, deletions among them, are not known.
+		b.since = b.Version
+		r.boards[b.Id] = b
+
+		// No one is connected yet.
+		for _, p := range b.Participants {
+			p.Online = false
+		}
+
+		// Timers which ran out meanwhile expire right away.
+		b.Mutex.Lock()
+		r.scheduleTimer(b)
+		b.Mutex.Unlock()
+	}
+	for _, t := range templates {
+		r.templates[t.Name] = t
+	}
+
+	return r, nil
+}
+
+// newBoard makes an empty board.
+func newBoard(id string) *Board {
 	b := &Board{
-		Id:      id,
-		Items:   make(map[string]*Item),
-		Version: 0,
+		Id:         id,
+		Items:      make(map[string]*Item),
+		Version:    0,
+		BoardState: BoardState{Columns: []Column{}},
 	}
-	b.Cond = sync.NewCond(&b.Mutex)
-	r.boards[id] = b
+	b.Changed = make(chan struct{})
+
 	return b
 }
 
+// Close stops the background work and closes the store.
+func (r *memoryRepo) Close() error {
+	r.mutex.Lock()
+	r.closed = true
+	for _, b := range r.boards {
+		b.Mutex.Lock()
+		b.stopTimers()
+		b.Mutex.Unlock()
+	}
+	r.mutex.Unlock()
+
+	close(r.done)
+	r.wg.Wait()
+
+	return r.store.Close()
+}
+
+// Compact compacts the store history into a snapshot, if the store
+// supports it. Changes are held back until the snapshot is taken.
+func (r *memoryRepo) Compact() error {
+	s, ok := r.store.(snapshotStore)
+	if !ok {
+		return nil
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	boards := make([]*Board, 0, len(r.boards))
+	for _, b := range r.boards {
+		b.Mutex.Lock()
+		defer b.Mutex.Unlock()
+		if !b.deleted {
+			boards = append(boards, b)
+		}
+	}
+
+	templates := make([]*Template, 0, len(r.templates))
+	for _, t := range r.templates {
+		templates = append(templates, t)
+	}
+
+	return s.Snapshot(boards, templates)
+}
+
+// compactEvery compacts the store at the given interval until the repo
+// is closed.
+func (r *memoryRepo) compactEvery(d time.Duration) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Compact(); err != nil {
+					log.Printf("compaction failed: %s", err)
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// CreateBoard creates a new board.
+func (r *memoryRepo) CreateBoard() (*Board, error) {
+	b := newBoard(uuid.New().String())
+	if err := r.addBoard(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// addBoard stores a new board and adds it to the registry. The registry
+// stays locked meanwhile, so that a compaction doesn't miss the board.
+func (r *memoryRepo) addBoard(b *Board) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.store.CreateBoard(b); err != nil {
+		return err
+	}
+	r.boards[b.Id] = b
+
+	return nil
+}
+
+// CreateBoardFromTemplate creates a new board with the columns of
+// the named template.
+func (r *memoryRepo) CreateBoardFromTemplate(name string) (*Board, error) {
+	r.mutex.RLock()
+	t := r.findTemplate(name)
+	r.mutex.RUnlock()
+
+	if t == nil {
+		return nil, errors.New("template_not_found")
+	}
+
+	b := newBoard(uuid.New().String())
+	for _, c := range t.Columns {
+		c.Id = uuid.New().String()
+		b.Columns = append(b.Columns, c)
+	}
+	renumberColumns(b.Columns)
+
+	if err := r.addBoard(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// findTemplate finds a built-in or custom template, nil if there is none.
+// Templates are replaced, not changed, so they can be used unlocked.
+// Must be called while holding the repo lock.
+func (r *memoryRepo) findTemplate(name string) *Template {
+	for _, t := range builtinTemplates {
+		if t.Name == name {
+			return t
+		}
+	}
+	return r.templates[name]
+}
+
+// GetTemplates lists the built-in templates followed by the custom ones
+// ordered by name.
+func (r *memoryRepo) GetTemplates() ([]*Template, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	custom := make([]*Template, 0, len(r.templates))
+	for _, t := range r.templates {
+		custom = append(custom, t)
+	}
+	sort.Slice(custom, func(i, j int) bool {
+		return custom[i].Name < custom[j].Name
+	})
+
+	return append(append([]*Template{}, builtinTemplates...), custom...), nil
+}
+
+// SaveTemplate registers a custom template, replacing the one with the
+// same name. Built-in templates can't be replaced.
+func (r *memoryRepo) SaveTemplate(t *Template) (*Template, error) {
+	if t == nil || t.Name == "" {
+		return nil, errors.New("input_error")
+	}
+
+	saved := *t
+	saved.BuiltIn = false
+	saved.Columns = make([]Column, len(t.Columns))
+	for i, c := range t.Columns {
+		// Columns get their ids on the boards.
+		c.Id = ""
+		saved.Columns[i] = c
+	}
+	renumberColumns(saved.Columns)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if found := r.findTemplate(saved.Name); found != nil && found.BuiltIn {
+		return nil, errors.New("template_read_only")
+	}
+	if err := r.store.SaveTemplate(&saved); err != nil {
+		return nil, err
+	}
+	r.templates[saved.Name] = &saved
+
+	return &saved, nil
+}
+
+// DeleteTemplate deletes a custom template and returns it.
+func (r *memoryRepo) DeleteTemplate(name string) (*Template, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	t := r.findTemplate(name)
+	if t == nil {
+		return nil, errors.New("template_not_found")
+	}
+	if t.BuiltIn {
+		return nil, errors.New("template_read_only")
+	}
+
+	if err := r.store.DeleteTemplate(name); err != nil {
+		return nil, err
+	}
+	delete(r.templates, name)
+
+	return t, nil
+}
+
 // GetBoard gets a board.
 func (r *memoryRepo) GetBoard(id string) (*Board, error) {
+	r.mutex.RLock()
 	b := r.boards[id]
+	r.mutex.RUnlock()
+
 	if b == nil {
 		return nil, errors.New("board_not_found")
 	}
 	return b, nil
 }
 
+// lockBoard gets a board and locks it. The caller must unlock the board.
+func (r *memoryRepo) lockBoard(id string) (*Board, error) {
+	b, err := r.GetBoard(id)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Mutex.Lock()
+	// The board may have been deleted meanwhile.
+	if b.deleted {
+		b.Mutex.Unlock()
+		return nil, errors.New("board_not_found")
+	}
+	return b, nil
+}
+
+// lockWritableBoard gets a board which is not archived and locks it.
+// The caller must unlock the board.
+func (r *memoryRepo) lockWritableBoard(id string) (*Board, error) {
+	b, err := r.lockBoard(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.Archived {
+		b.Mutex.Unlock()
+		return nil, ErrBoardArchived
+	}
+	return b, nil
+}
+
+// lockBoardFor gets a board whose phase allows the operation and locks it.
+// The caller must unlock the board.
+func (r *memoryRepo) lockBoardFor(id string, op string) (*Board, error) {
+	b, err := r.lockWritableBoard(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPhase(b, op); err != nil {
+		b.Mutex.Unlock()
+		return nil, err
+	}
+	return b, nil
+}
+
 // UpdateBoard updates the board version and broadcasts the update to listeners.
-func (r *memoryRepo) UpdateBoard(b *Board, it *Item) {
+func (r *memoryRepo) UpdateBoard(b *Board, it *Item) error {
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+
+	if err := r.store.UpdateBoard(b.Id, b.Version+1, &b.BoardState); err != nil {
+		return err
+	}
+	r.commit(b, it)
+
+	return nil
+}
+
+// ArchiveBoard makes a board read-only, stops its timer and makes its
+// participants offline.
+func (r *memoryRepo) ArchiveBoard(id string) (*Board, error) {
+	b, err := r.lockBoard(id)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if !b.Archived {
+		state := b.clone()
+		state.Archived = true
+		// A running timer stops where it is.
+		if state.Timer != nil && state.Timer.Running {
+			state.Timer.pause(time.Now().UTC())
+		}
+		for _, p := range state.Participants {
+			p.Online = false
+		}
+		if err := r.updateState(b, state); err != nil {
+			return nil, err
+		}
+		b.stopTimers()
+		b.expiry = nil
+		b.heartbeats = nil
+	}
+
+	return b, nil
+}
+
+// updateState stores the board state and notifies the listeners.
+// Must be called while holding the board lock.
+func (r *memoryRepo) updateState(b *Board, state BoardState) error {
+	if err := r.store.UpdateBoard(b.Id, b.Version+1, &state); err != nil {
+		return err
+	}
+	b.BoardState = state
+
+	// Notify listeners.
+	r.commit(b)
+
+	return nil
+}
+
+// DeleteBoard deletes a board and returns it.
+// The listeners of the board are told that it is deleted.
+func (r *memoryRepo) DeleteBoard(id string) (*Board, error) {
+	b, err := r.lockBoard(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.store.DeleteBoard(b.Id); err != nil {
+		b.Mutex.Unlock()
+		return nil, err
+	}
+
+	b.stopTimers()
+
+	// Wake up the listeners.
+	b.deleted = true
+	close(b.Changed)
+	b.Changed = make(chan struct{})
+	b.Mutex.Unlock()
+
+	// The registry is locked before the boards elsewhere, so not here.
+	r.mutex.Lock()
+	delete(r.boards, b.Id)
+	r.mutex.Unlock()
+
+	return b, nil
+}
+
+// commit increments the board version, records the changed items
+// and broadcasts the update to listeners.
+// Must be called while holding the board lock.
+func (r *memoryRepo) commit(b *Board, items ...*Item) {
 	// Increment the board version.
 	v := atomic.AddUint64(&b.Version, 1)
 
-	// Update item version.
-	if it != nil {
+	// Update item versions and record the changes.
+	for _, it := range items {
+		if it == nil {
+			continue
+		}
 		atomic.StoreUint64(&it.Version, v)
+		b.changes = append(b.changes, Change{Version: v, ItemId: it.Id})
+	}
+	if len(b.changes) > maxChanges {
+		b.trimChanges(b.changes[len(b.changes)-maxChanges/2-1].Version)
 	}
 
 	// Broadcast listeners.
-	b.Cond.Broadcast()
+	close(b.Changed)
+	b.Changed = make(chan struct{})
+}
+
+// trimChanges drops the change log entries and the text operations up to
+// the given version. Polls from before it get the whole board.
+// Must be called while holding the board lock.
+func (b *Board) trimChanges(version uint64) {
+	i := sort.Search(len(b.changes), func(i int) bool {
+		return b.changes[i].Version > version
+	})
+	b.changes = append([]Change(nil), b.changes[i:]...)
+	for _, it := range b.Items {
+		if it.TextDoc != nil {
+			it.TextDoc.trimOps(version)
+		}
+	}
+	b.since = version
 }
 
-func (r *memoryRepo) GetBoardUpdates(b *Board, version uint64) {
-	b.Cond.L.Lock()
-	b.Cond.Wait()
-	b.Cond.L.Unlock()
+// GetBoardUpdates waits until the board version is greater than the given
+// version and returns a board containing only the items changed since then.
+// A version ahead of the board was seen before a restart, as presence
+// changes are not stored, and gets the whole board right away.
+// Returns the context error if the context is done before any change,
+// ErrBoardDeleted if the board is deleted.
+func (r *memoryRepo) GetBoardUpdates(ctx context.Context, b *Board, version uint64) (*Board, error) {
+	for {
+		b.Mutex.Lock()
+		if b.deleted {
+			b.Mutex.Unlock()
+			return nil, ErrBoardDeleted
+		}
+		if b.Version != version {
+			delta := r.changesSince(b, version)
+			b.Mutex.Unlock()
+			return delta, nil
+		}
+		changed := b.Changed
+		b.Mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// changesSince collects the items, groups and action items changed or
+// deleted after the given version. The groups of changed items come along for their votes.
+// Returns the whole board if the change log doesn't go back that far or
+// the version is ahead of the board.
+// Must be called while holding the board lock.
+func (r *memoryRepo) changesSince(b *Board, version uint64) *Board {
+	delta := &Board{
+		Id:         b.Id,
+		Items:      make(map[string]*Item),
+		Version:    b.Version,
+		BoardState: b.clone(),
+	}
+
+	if version < b.since || version > b.Version {
+		delta.Full = true
+		for id, it := range b.Items {
+			delta.Items[id] = it.clone()
+		}
+		for id, g := range b.Groups {
+			delta.Groups[id] = groupView(b, g)
+		}
+		return delta
+	}
+	delta.Groups = nil
+	delta.Actions = nil
+	addGroup := func(g *Group) {
+		if delta.Groups == nil {
+			delta.Groups = make(map[string]*Group)
+		}
+		delta.Groups[g.Id] = groupView(b, g)
+	}
+
+	// The change log is ordered by version.
+	i := sort.Search(len(b.changes), func(i int) bool {
+		return b.changes[i].Version > version
+	})
+
+	seen := make(map[string]bool)
+	for _, c := range b.changes[i:] {
+		if c.ActionId != "" {
+			if seen[c.ActionId] {
+				continue
+			}
+			seen[c.ActionId] = true
+
+			if a, ok := b.Actions[c.ActionId]; ok {
+				if delta.Actions == nil {
+					delta.Actions = make(map[string]*Action)
+				}
+				action := *a
+				delta.Actions[c.ActionId] = &action
+			} else {
+				delta.DeletedActions = append(delta.DeletedActions, c.ActionId)
+			}
+			continue
+		}
+
+		if c.GroupId != "" {
+			if seen[c.GroupId] {
+				continue
+			}
+			seen[c.GroupId] = true
+
+			if g, ok := b.Groups[c.GroupId]; ok {
+				addGroup(g)
+			} else {
+				delta.DeletedGroups = append(delta.DeletedGroups, c.GroupId)
+			}
+			continue
+		}
+
+		if seen[c.ItemId] {
+			continue
+		}
+		seen[c.ItemId] = true
+
+		if g := b.groupOf(c.ItemId); g != nil {
+			addGroup(g)
+		}
+		if it, ok := b.Items[c.ItemId]; ok {
+			delta.Items[c.ItemId] = it.clone()
+			if ops := textOpsSince(it, version); len(ops) > 0 {
+				if delta.TextOps == nil {
+					delta.TextOps = make(map[string][]TextOp)
+				}
+				delta.TextOps[c.ItemId] = ops
+			}
+		} else {
+			delta.DeletedItems = append(delta.DeletedItems, c.ItemId)
+		}
+	}
+
+	return delta
 }
 
 // CreateItem creates a new item.
 func (r *memoryRepo) CreateItem(boardId string, item *Item) (*Item, error) {
-	b, err := r.GetBoard(boardId)
+	b, err := r.lockBoardFor(boardId, opCreateItem)
 	if err != nil {
 		return nil, err
 	}
+	defer b.Mutex.Unlock()
+
 	retItem := *item
 	retItem.Id = uuid.New().String()
+	// The text document starts with the first character edit.
+	retItem.TextDoc = nil
+	retItem.Votes = nil
+	retItem.Comments = nil
+	retItem.Reactions = nil
+	retItem.Hidden = false
+	if err := checkColumn(b, &retItem); err != nil {
+		return nil, err
+	}
+
+	// Store the item with the upcoming version.
+	retItem.Version = b.Version + 1
+	if err := r.store.CreateItem(b.Id, &retItem); err != nil {
+		return nil, err
+	}
+
 	b.Items[retItem.Id] = &retItem
 
 	// Notify listeners.
-	r.UpdateBoard(b, &retItem)
+	r.commit(b, &retItem)
 
-	return &retItem, nil
+	// Return a copy, the stored item is guarded by the board lock.
+	return retItem.clone(), nil
 }
 
-// GetItem gets an item.
+// GetItem gets a copy of an item.
 func (r *memoryRepo) GetItem(b *Board, itemId string) (*Item, error) {
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+
+	item, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	return item.clone(), nil
+}
+
+// getItem gets an item.
+// Must be called while holding the board lock.
+func (r *memoryRepo) getItem(b *Board, itemId string) (*Item, error) {
 	item, ok := b.Items[itemId]
 	if !ok {
 		return nil, errors.New("item_not_found")
@@ -102,13 +748,14 @@ func (r *memoryRepo) GetItem(b *Board, itemId string) (*Item, error) {
 // UpdateItem updates an existing item.
 func (r *memoryRepo) UpdateItem(boardId string, itemId string, item *Item) (*Item, error) {
 	// Find the board
-	b, err := r.GetBoard(boardId)
+	b, err := r.lockBoardFor(boardId, opEditItem)
 	if err != nil {
 		return nil, err
 	}
+	defer b.Mutex.Unlock()
 
 	// Get the existing item.
-	oItem, err := r.GetItem(b, itemId)
+	oItem, err := r.getItem(b, itemId)
 	if err != nil {
 		return nil, err
 	}
@@ -117,13 +764,586 @@ func (r *memoryRepo) UpdateItem(boardId string, itemId string, item *Item) (*Ite
 		return nil, errors.New("input_error")
 	}
 
+	// The update must be based on the stored version, if it is given.
+	if err := checkVersion(oItem, item.Version); err != nil {
+		return nil, err
+	}
+
 	// Copy data from received item.
-	*oItem = *item
+	updated := *item
 	// No highjacking.
-	oItem.Id = itemId
+	updated.Id = itemId
+	keepServerData(oItem, &updated, b.Version+1)
+
+	return r.replaceItem(b, oItem, updated)
+}
+
+// PatchItem changes the fields of an existing item which are in the JSON
+// merge patch (RFC 7396). Fields set to null are cleared.
+// A version in the patch must match the stored version.
+func (r *memoryRepo) PatchItem(boardId string, itemId string, patch []byte) (*Item, error) {
+	b, err := r.lockBoardFor(boardId, opEditItem)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, errors.New("input_error")
+	}
+	fieldChanges, ok := changes.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("input_error")
+	}
+
+	// The patch must be based on the stored version, if it is given.
+	if v, ok := fieldChanges["version"]; ok {
+		version, ok := v.(float64)
+		if !ok {
+			return nil, errors.New("input_error")
+		}
+		if err := checkVersion(oItem, uint64(version)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Patch the JSON form of the item.
+	var fields interface{}
+	data, _ := json.Marshal(oItem)
+	json.Unmarshal(data, &fields)
+	data, _ = json.Marshal(mergePatch(fields, changes))
+
+	updated := Item{}
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return nil, errors.New("input_error")
+	}
+	// No highjacking.
+	updated.Id = itemId
+	keepServerData(oItem, &updated, b.Version+1)
+
+	return r.replaceItem(b, oItem, updated)
+}
+
+// checkVersion checks that a change based on the given item version can be
+// applied to the stored item. Zero means any version.
+func checkVersion(oItem *Item, version uint64) error {
+	if version != 0 && version != oItem.Version {
+		return &ConflictError{Item: oItem.clone()}
+	}
+	return nil
+}
+
+// replaceItem stores the updated item in place of the existing one
+// and notifies the listeners. Returns a copy of the updated item.
+// Must be called while holding the board lock.
+func (r *memoryRepo) replaceItem(b *Board, oItem *Item, updated Item) (*Item, error) {
+	if err := checkColumn(b, &updated); err != nil {
+		return nil, err
+	}
+
+	// Store the item with the upcoming version.
+	updated.Version = b.Version + 1
+	if err := r.store.UpdateItem(b.Id, &updated); err != nil {
+		return nil, err
+	}
+	*oItem = updated
+
+	// Notify listeners.
+	r.commit(b, oItem)
+
+	return oItem.clone(), nil
+}
+
+// checkColumn checks that the column of an item is on the board.
+// Must be called while holding the board lock.
+func checkColumn(b *Board, item *Item) error {
+	if item.ColumnId != "" && b.columnIndex(item.ColumnId) < 0 {
+		return errors.New("column_not_found")
+	}
+	return nil
+}
+
+// keepServerData carries the item data managed by the server over to an
+// update from a client. A changed text is merged into the text document.
+func keepServerData(oItem *Item, updated *Item, version uint64) {
+	updated.Author = oItem.Author
+	updated.Hidden = false
+	updated.Votes = copyCounts(oItem.Votes)
+	kept := oItem.clone()
+	updated.Comments = kept.Comments
+	updated.Reactions = kept.Reactions
+	updated.TextDoc = nil
+	if oItem.TextDoc != nil {
+		updated.TextDoc = oItem.TextDoc.clone()
+		if updated.Text != oItem.Text {
+			updated.TextDoc.setText(updated.Text, version)
+		}
+	}
+}
+
+// CreateColumn adds a new column at the end of the board.
+func (r *memoryRepo) CreateColumn(boardId string, column *Column) (*Column, error) {
+	b, err := r.lockBoardFor(boardId, opEditColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	created := *column
+	created.Id = uuid.New().String()
+	created.Order = len(b.Columns)
+
+	state := b.clone()
+	state.Columns = append(state.Columns, created)
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// UpdateColumn changes the title and color of a column.
+func (r *memoryRepo) UpdateColumn(boardId string, columnId string, column *Column) (*Column, error) {
+	b, err := r.lockBoardFor(boardId, opEditColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	i := b.columnIndex(columnId)
+	if i < 0 {
+		return nil, errors.New("column_not_found")
+	}
+
+	state := b.clone()
+	state.Columns[i].Title = column.Title
+	state.Columns[i].Color = column.Color
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+
+	updated := state.Columns[i]
+	return &updated, nil
+}
+
+// MoveColumn moves a column to the given position, shifting the others.
+func (r *memoryRepo) MoveColumn(boardId string, columnId string, order int) (*Column, error) {
+	b, err := r.lockBoardFor(boardId, opEditColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	i := b.columnIndex(columnId)
+	if i < 0 {
+		return nil, errors.New("column_not_found")
+	}
+	if order < 0 || order >= len(b.Columns) {
+		return nil, errors.New("input_error")
+	}
+
+	state := b.clone()
+	moved := state.Columns[i]
+	state.Columns = append(state.Columns[:i], state.Columns[i+1:]...)
+	state.Columns = append(state.Columns[:order], append([]Column{moved}, state.Columns[order:]...)...)
+	renumberColumns(state.Columns)
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+
+	moved = state.Columns[order]
+	return &moved, nil
+}
+
+// DeleteColumn deletes a column and returns it.
+// The items of the column are left without a column.
+func (r *memoryRepo) DeleteColumn(boardId string, columnId string) (*Column, error) {
+	b, err := r.lockBoardFor(boardId, opEditColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	i := b.columnIndex(columnId)
+	if i < 0 {
+		return nil, errors.New("column_not_found")
+	}
+
+	// The items of the column are left without one.
+	var items, updated []*Item
+	for _, it := range b.Items {
+		if it.ColumnId != columnId {
+			continue
+		}
+		u := it.clone()
+		u.ColumnId = ""
+		u.Version = b.Version + 1
+		items = append(items, it)
+		updated = append(updated, u)
+	}
+
+	state := b.clone()
+	deleted := state.Columns[i]
+	state.Columns = append(state.Columns[:i], state.Columns[i+1:]...)
+	renumberColumns(state.Columns)
+
+	// Store the column and its items with the upcoming version at once.
+	if err := r.store.UpdateBoardItems(b.Id, b.Version+1, &state, updated, nil); err != nil {
+		return nil, err
+	}
+
+	b.BoardState = state
+	for j, it := range items {
+		*it = *updated[j]
+	}
 
 	// Notify listeners.
-	r.UpdateBoard(b, oItem)
+	r.commit(b, items...)
+
+	return &deleted, nil
+}
+
+// renumberColumns sets the order of the columns to their position.
+func renumberColumns(columns []Column) {
+	for i := range columns {
+		columns[i].Order = i
+	}
+}
+
+// DeleteItem deletes an item and returns it.
+func (r *memoryRepo) DeleteItem(boardId string, itemId string) (*Item, error) {
+	b, err := r.lockBoardFor(boardId, opEditItem)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	item, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	// The item leaves its group and its action items, stored at once
+	// with the deletion.
+	state := b.clone()
+	groupId := ungroupItem(&state, itemId, b.Version+1)
+	actionIds := unlinkItem(&state, itemId, b.Version+1)
+	stateChanged := groupId != "" || len(actionIds) > 0
+	if stateChanged {
+		err = r.store.UpdateBoardItems(b.Id, b.Version+1, &state, nil, []string{itemId})
+	} else {
+		err = r.store.DeleteItem(b.Id, itemId, b.Version+1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stateChanged {
+		b.BoardState = state
+		if groupId != "" {
+			r.recordGroups(b, groupId)
+		}
+		r.recordActions(b, actionIds...)
+	}
+	delete(b.Items, itemId)
 
-	return oItem, nil
+	// Notify listeners, the change log keeps the tombstone.
+	r.commit(b, item)
+
+	return item, nil
+}
+
+// EditText merges character operations into the text of an item.
+// The operations are applied in order, either all of them or none.
+func (r *memoryRepo) EditText(boardId string, itemId string, ops []TextOp) (*Item, error) {
+	b, err := r.lockBoardFor(boardId, opEditItem)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		return nil, errors.New("input_error")
+	}
+
+	updated := *oItem.clone()
+	if updated.TextDoc == nil {
+		updated.TextDoc = newTextDoc(oItem.Text)
+	}
+	for _, op := range ops {
+		// The server site is reserved for the server.
+		if op.Type == textInsert && op.Id.Site == serverSite {
+			return nil, errors.New("invalid_text_op")
+		}
+		if err := updated.TextDoc.apply(op, b.Version+1); err != nil {
+			return nil, err
+		}
+	}
+	updated.Text = updated.TextDoc.text()
+
+	return r.replaceItem(b, oItem, updated)
+}
+
+// AddVote adds a vote of a participant to an item. The participant can't
+// vote more than the vote budget across the board.
+func (r *memoryRepo) AddVote(boardId string, itemId string, participantId string) (*Item, error) {
+	if participantId == "" {
+		return nil, errors.New("input_error")
+	}
+
+	b, err := r.lockBoardFor(boardId, opVote)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	if budget := b.voteBudget(participantId); budget > 0 && votesOf(b, participantId) >= budget {
+		return nil, ErrVoteBudgetExceeded
+	}
+
+	updated := *oItem.clone()
+	if updated.Votes == nil {
+		updated.Votes = make(map[string]int)
+	}
+	updated.Votes[participantId]++
+
+	return r.replaceVotes(b, oItem, updated)
+}
+
+// RemoveVote takes back a vote of a participant from an item.
+func (r *memoryRepo) RemoveVote(boardId string, itemId string, participantId string) (*Item, error) {
+	b, err := r.lockBoardFor(boardId, opVote)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	oItem, err := r.getItem(b, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	if oItem.Votes[participantId] == 0 {
+		return nil, errors.New("vote_not_found")
+	}
+
+	updated := *oItem.clone()
+	updated.Votes[participantId]--
+	if updated.Votes[participantId] == 0 {
+		delete(updated.Votes, participantId)
+	}
+
+	return r.replaceVotes(b, oItem, updated)
+}
+
+// replaceVotes stores the item with changed votes in place of the existing
+// one. While the votes are hidden the change stays out of the change log,
+// so that neither the board updates nor the versions tell the others about
+// it. Revealing the votes sends the whole board.
+// Must be called while holding the board lock.
+func (r *memoryRepo) replaceVotes(b *Board, oItem *Item, updated Item) (*Item, error) {
+	if !b.HideVotes {
+		return r.replaceItem(b, oItem, updated)
+	}
+
+	// The item keeps its version and the board its own.
+	if err := r.store.UpdateBoardItems(b.Id, b.Version, &b.BoardState, []*Item{&updated}, nil); err != nil {
+		return nil, err
+	}
+	*oItem = updated
+
+	return oItem.clone(), nil
+}
+
+// votesOf counts the votes of a participant on the board.
+// Must be called while holding the board lock.
+func votesOf(b *Board, participantId string) int {
+	count := 0
+	for _, it := range b.Items {
+		count += it.Votes[participantId]
+	}
+	return count
+}
+
+// SetVoteBudget sets how many votes the participants of a board have,
+// or a participant has if the budget names one. Zero means no limit.
+// Votes already given are kept. Only the facilitator can set the budget,
+// if the board has one.
+func (r *memoryRepo) SetVoteBudget(boardId string, participantId string, budget VoteBudget) (*Board, error) {
+	if budget.Budget < 0 {
+		return nil, errors.New("input_error")
+	}
+
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if err := checkFacilitator(b, participantId); err != nil {
+		return nil, err
+	}
+
+	state := b.clone()
+	if budget.ParticipantId == "" {
+		state.VoteBudget = budget.Budget
+	} else {
+		if state.VoteBudgets == nil {
+			state.VoteBudgets = make(map[string]int)
+		}
+		state.VoteBudgets[budget.ParticipantId] = budget.Budget
+	}
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// SetFacilitator makes a participant the facilitator of a board.
+// Only the facilitator can hand the role over, anyone can take it if the
+// board has none.
+func (r *memoryRepo) SetFacilitator(boardId string, participantId string, facilitatorId string) (*Board, error) {
+	if facilitatorId == "" {
+		return nil, errors.New("input_error")
+	}
+
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if err := checkFacilitator(b, participantId); err != nil {
+		return nil, err
+	}
+
+	state := b.clone()
+	state.Facilitator = facilitatorId
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// SetVisibility sets what the participants of a board see of each other.
+// Only the facilitator can change it, if the board has one.
+func (r *memoryRepo) SetVisibility(boardId string, participantId string, visibility Visibility) (*Board, error) {
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if err := checkFacilitator(b, participantId); err != nil {
+		return nil, err
+	}
+
+	state := b.clone()
+	state.Visibility = visibility
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+
+	// Items revealed or hidden didn't change, so the listeners get
+	// the whole board.
+	b.trimChanges(b.Version)
+
+	return b, nil
+}
+
+// SetPhase moves a board to the given phase, or the next one if the phase
+// is empty. Only the facilitator can change it, if the board has one.
+func (r *memoryRepo) SetPhase(boardId string, participantId string, phase string) (*Board, error) {
+	if phase != "" && !validPhase(phase) {
+		return nil, errors.New("invalid_phase")
+	}
+
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if err := checkFacilitator(b, participantId); err != nil {
+		return nil, err
+	}
+
+	if phase == "" {
+		if phase, err = nextPhase(b.Phase); err != nil {
+			return nil, err
+		}
+	}
+
+	state := b.clone()
+	state.Phase = phase
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// checkFacilitator checks that a participant can run the board.
+// Must be called while holding the board lock.
+func checkFacilitator(b *Board, participantId string) error {
+	if b.Facilitator != "" && b.Facilitator != participantId {
+		return ErrNotFacilitator
+	}
+	return nil
+}
+
+// GetRanking returns copies of the items of a board, the most voted first.
+func (r *memoryRepo) GetRanking(boardId string) ([]*Item, error) {
+	b, err := r.lockBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	// The order would tell the hidden votes.
+	if b.HideVotes {
+		return nil, ErrVotesHidden
+	}
+
+	items := make([]*Item, 0, len(b.Items))
+	for _, it := range b.Items {
+		items = append(items, it.clone())
+	}
+	sort.Slice(items, func(i, j int) bool {
+		ci, cj := items[i].voteCount(), items[j].voteCount()
+		if ci != cj {
+			return ci > cj
+		}
+		// Keep the order stable on a tie.
+		return items[i].Id < items[j].Id
+	})
+
+	return items, nil
+}
+
+// textOpsSince returns the text operations of an item merged after the
+// given version.
+func textOpsSince(it *Item, version uint64) []TextOp {
+	if it.TextDoc == nil {
+		return nil
+	}
+	return it.TextDoc.opsSince(version)
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -10,8 +13,9 @@ import (
 
 func TestRepoCreateBoard(t *testing.T) {
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, err := r.CreateBoard()
 
+	assert.NoError(t, err)
 	assert.Equal(t, len(b.Id), 36)
 	assert.Zero(t, b.Version)
 	assert.NotNil(t, b.Items)
@@ -19,7 +23,7 @@ func TestRepoCreateBoard(t *testing.T) {
 
 func TestRepoGetBoard(t *testing.T) {
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, _ := r.CreateBoard()
 	result, err := r.GetBoard(b.Id)
 
 	assert.NoError(t, err)
@@ -34,7 +38,7 @@ func TestRepoGetBoard(t *testing.T) {
 
 func TestRepoUpdateBoard(t *testing.T) {
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, _ := r.CreateBoard()
 	i := Item{}
 	r.UpdateBoard(b, &i)
 
@@ -47,14 +51,16 @@ func TestRepoUpdateBoard(t *testing.T) {
 
 func TestRepoGetBoardUpdates(t *testing.T) {
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, _ := r.CreateBoard()
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 
 	go func() {
 		// Waiting for updates...
-		r.GetBoardUpdates(b, 0)
+		updates, err := r.GetBoardUpdates(context.Background(), b, 0)
 		// Updates received.
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, updates.Version)
 		wg.Done()
 	}()
 
@@ -64,6 +70,50 @@ func TestRepoGetBoardUpdates(t *testing.T) {
 	wg.Wait()
 }
 
+func TestRepoGetBoardUpdatesDelta(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	first, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	second, _ := r.CreateItem(b.Id, &Item{Text: "bar"})
+	r.UpdateItem(b.Id, first.Id, &Item{Text: "baz"})
+
+	// Changes are returned immediately without waiting.
+	updates, _ := r.GetBoardUpdates(context.Background(), b, 0)
+	assert.EqualValues(t, 3, updates.Version)
+	assert.Len(t, updates.Items, 2)
+
+	// Only the items changed after the version are returned.
+	updates, _ = r.GetBoardUpdates(context.Background(), b, 2)
+	assert.EqualValues(t, 3, updates.Version)
+	assert.Len(t, updates.Items, 1)
+	assert.Equal(t, "baz", updates.Items[first.Id].Text)
+	assert.NotContains(t, updates.Items, second.Id)
+}
+
+func TestRepoGetBoardUpdatesContext(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+
+	// Gives up when the timeout passes.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	updates, err := r.GetBoardUpdates(ctx, b, 0)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, updates)
+
+	// Gives up when the context is cancelled.
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		<-time.After(time.Millisecond * 10)
+		cancel()
+	}()
+
+	updates, err = r.GetBoardUpdates(ctx, b, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, updates)
+}
+
 func TestRepoCreateItem(t *testing.T) {
 	item := &Item{
 		Id:      "foo",
@@ -77,7 +127,7 @@ func TestRepoCreateItem(t *testing.T) {
 	}
 
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, _ := r.CreateBoard()
 	created, err := r.CreateItem(b.Id, item)
 
 	assert.NoError(t, err)
@@ -109,7 +159,7 @@ func TestRepoGetItem(t *testing.T) {
 	}
 
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, _ := r.CreateBoard()
 	created, _ := r.CreateItem(b.Id, item)
 	result, err := r.GetItem(b, created.Id)
 
@@ -146,7 +196,7 @@ func TestRepoUpdateItem(t *testing.T) {
 	}
 
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, _ := r.CreateBoard()
 	created, _ := r.CreateItem(b.Id, createInput)
 	updated, err := r.UpdateItem(b.Id, created.Id, updateInput)
 
@@ -203,7 +253,7 @@ func TestRepoUpdateItemErrors(t *testing.T) {
 	}
 
 	r := NewMemoryRepo()
-	b := r.CreateBoard()
+	b, _ := r.CreateBoard()
 	created, _ := r.CreateItem(b.Id, createInput)
 
 	errorCases := []struct {
@@ -222,3 +272,1067 @@ func TestRepoUpdateItemErrors(t *testing.T) {
 		assert.Nil(t, notFound)
 	}
 }
+
+func TestRepoConcurrentBoards(t *testing.T) {
+	r := NewMemoryRepo()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			b, err := r.CreateBoard()
+			assert.NoError(t, err)
+			result, err := r.GetBoard(b.Id)
+			assert.NoError(t, err)
+			assert.Equal(t, b, result)
+
+			// Look up a board which may not exist yet.
+			r.GetBoard("not_existing_board_id")
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestRepoConcurrentItems(t *testing.T) {
+	const writers = 20
+	const updates = 50
+
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	ctx, cancel := context.WithCancel(context.Background())
+	writing := sync.WaitGroup{}
+	reading := sync.WaitGroup{}
+
+	// Writers create an item each and update it repeatedly.
+	for i := 0; i < writers; i++ {
+		writing.Add(1)
+		go func() {
+			defer writing.Done()
+
+			item, err := r.CreateItem(b.Id, &Item{Text: "foo"})
+			assert.NoError(t, err)
+
+			for j := 0; j < updates; j++ {
+				_, err = r.UpdateItem(b.Id, item.Id, &Item{Text: "bar", Left: float32(j)})
+				assert.NoError(t, err)
+
+				_, err = r.GetItem(b, item.Id)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+
+	// Readers encode the board while it changes.
+	for i := 0; i < 5; i++ {
+		reading.Add(1)
+		go func() {
+			defer reading.Done()
+
+			for ctx.Err() == nil {
+				_, err := json.Marshal(b)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+
+	// Pollers follow the updates until the last one.
+	for i := 0; i < 5; i++ {
+		reading.Add(1)
+		go func() {
+			defer reading.Done()
+
+			var version uint64
+			for version < writers*(updates+1) {
+				delta, err := r.GetBoardUpdates(context.Background(), b, version)
+				if !assert.NoError(t, err) {
+					return
+				}
+				_, err = json.Marshal(delta)
+				assert.NoError(t, err)
+				version = delta.Version
+			}
+		}()
+	}
+
+	writing.Wait()
+	cancel()
+	reading.Wait()
+
+	assert.EqualValues(t, writers*(updates+1), b.Version)
+	assert.Len(t, b.Items, writers)
+}
+
+func TestRepoDeleteItem(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	kept, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	created, _ := r.CreateItem(b.Id, &Item{Text: "bar"})
+	r.UpdateItem(b.Id, created.Id, &Item{Text: "baz"})
+
+	deleted, err := r.DeleteItem(b.Id, created.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, created.Id, deleted.Id)
+	assert.EqualValues(t, 4, b.Version)
+
+	_, err = r.GetItem(b, created.Id)
+	assert.Error(t, err)
+
+	// The deletion is delivered as a tombstone.
+	updates, err := r.GetBoardUpdates(context.Background(), b, 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, updates.Version)
+	assert.Empty(t, updates.Items)
+	assert.Equal(t, []string{created.Id}, updates.DeletedItems)
+
+	// Older changes are still delivered.
+	updates, _ = r.GetBoardUpdates(context.Background(), b, 0)
+	assert.Contains(t, updates.Items, kept.Id)
+	assert.Equal(t, []string{created.Id}, updates.DeletedItems)
+
+	errorCases := []struct {
+		BoardId string
+		ItemId  string
+	}{
+		{BoardId: "not_existing_board_id", ItemId: kept.Id},
+		{BoardId: b.Id, ItemId: "not_existing_item_id"},
+		{BoardId: b.Id, ItemId: created.Id},
+	}
+
+	for _, errorCase := range errorCases {
+		notFound, err := r.DeleteItem(errorCase.BoardId, errorCase.ItemId)
+		assert.Error(t, err)
+		assert.Nil(t, notFound)
+	}
+}
+
+func TestRepoArchiveBoard(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	item, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+
+	archived, err := r.ArchiveBoard(b.Id)
+	assert.NoError(t, err)
+	assert.True(t, archived.Archived)
+	assert.EqualValues(t, 2, b.Version)
+
+	// Listeners are told about the archival.
+	updates, err := r.GetBoardUpdates(context.Background(), b, 1)
+	assert.NoError(t, err)
+	assert.True(t, updates.Archived)
+	assert.Empty(t, updates.Items)
+
+	// The board is read-only.
+	_, err = r.CreateItem(b.Id, &Item{Text: "bar"})
+	assert.ErrorIs(t, err, ErrBoardArchived)
+	_, err = r.UpdateItem(b.Id, item.Id, &Item{Text: "bar"})
+	assert.ErrorIs(t, err, ErrBoardArchived)
+	_, err = r.DeleteItem(b.Id, item.Id)
+	assert.ErrorIs(t, err, ErrBoardArchived)
+
+	// Archiving again changes nothing.
+	_, err = r.ArchiveBoard(b.Id)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, b.Version)
+
+	_, err = r.ArchiveBoard("not_existing_board_id")
+	assert.Error(t, err)
+}
+
+func TestRepoDeleteBoard(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		// Waiting for updates...
+		updates, err := r.GetBoardUpdates(context.Background(), b, 0)
+		// Woken up by the deletion.
+		assert.ErrorIs(t, err, ErrBoardDeleted)
+		assert.Nil(t, updates)
+		wg.Done()
+	}()
+
+	<-time.After(time.Millisecond * 10)
+	deleted, err := r.DeleteBoard(b.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, b.Id, deleted.Id)
+
+	wg.Wait()
+
+	_, err = r.GetBoard(b.Id)
+	assert.Error(t, err)
+	_, err = r.CreateItem(b.Id, &Item{Text: "foo"})
+	assert.Error(t, err)
+	_, err = r.DeleteBoard(b.Id)
+	assert.Error(t, err)
+}
+
+func TestRepoPatchItem(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	created, _ := r.CreateItem(b.Id, &Item{
+		Text:   "foo",
+		Color:  "red",
+		Left:   1,
+		Top:    2,
+		Width:  3,
+		Height: 4,
+	})
+
+	// Only the fields in the patch change.
+	patched, err := r.PatchItem(b.Id, created.Id, []byte(`{"left": 10, "top": 20, "id": "hijack"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &Item{
+		Id:      created.Id,
+		Version: 2,
+		Text:    "foo",
+		Color:   "red",
+		Left:    10,
+		Top:     20,
+		Width:   3,
+		Height:  4,
+	}, patched)
+
+	// Null clears a field.
+	patched, err = r.PatchItem(b.Id, created.Id, []byte(`{"color": null}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "", patched.Color)
+	assert.Equal(t, "foo", patched.Text)
+
+	result, _ := r.GetItem(b, created.Id)
+	assert.Equal(t, patched, result)
+
+	errorCases := []struct {
+		BoardId string
+		ItemId  string
+		Patch   string
+	}{
+		{BoardId: "not_existing_board_id", ItemId: created.Id, Patch: `{}`},
+		{BoardId: b.Id, ItemId: "not_existing_item_id", Patch: `{}`},
+		{BoardId: b.Id, ItemId: created.Id, Patch: `invalid: json`},
+		{BoardId: b.Id, ItemId: created.Id, Patch: `["text"]`},
+		{BoardId: b.Id, ItemId: created.Id, Patch: `{"left": "far"}`},
+	}
+
+	for _, errorCase := range errorCases {
+		notFound, err := r.PatchItem(errorCase.BoardId, errorCase.ItemId, []byte(errorCase.Patch))
+		assert.Error(t, err)
+		assert.Nil(t, notFound)
+	}
+	assert.EqualValues(t, 3, b.Version)
+}
+
+func TestRepoUpdateItemConflict(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	created, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	r.UpdateItem(b.Id, created.Id, &Item{Text: "bar"})
+
+	// Updates based on an older version are rejected with the stored item.
+	_, err := r.UpdateItem(b.Id, created.Id, &Item{Version: created.Version, Text: "baz"})
+	var conflict *ConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, "bar", conflict.Item.Text)
+		assert.EqualValues(t, 2, conflict.Item.Version)
+	}
+
+	_, err = r.PatchItem(b.Id, created.Id, []byte(`{"text": "baz", "version": 1}`))
+	assert.ErrorAs(t, err, &conflict)
+	assert.EqualValues(t, 2, b.Version)
+
+	// Updates based on the stored version are applied.
+	updated, err := r.UpdateItem(b.Id, created.Id, &Item{Version: 2, Text: "baz"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, updated.Version)
+
+	patched, err := r.PatchItem(b.Id, created.Id, []byte(`{"text": "qux", "version": 3}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "qux", patched.Text)
+	assert.EqualValues(t, 4, patched.Version)
+}
+
+func TestRepoEditText(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	created, _ := r.CreateItem(b.Id, &Item{Text: "ab", TextDoc: &TextDoc{}})
+	assert.Nil(t, created.TextDoc)
+
+	// Characters of an unedited text are numbered from 1.
+	edited, err := r.EditText(b.Id, created.Id, []TextOp{
+		{Type: textInsert, Id: TextId{Counter: 3, Site: "alice"}, After: TextId{Counter: 1}, Char: "x"},
+		{Type: textDelete, Id: TextId{Counter: 2}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ax", edited.Text)
+	assert.EqualValues(t, 2, edited.Version)
+
+	// A concurrent insert at the same place is merged.
+	edited, err = r.EditText(b.Id, created.Id, []TextOp{
+		{Type: textInsert, Id: TextId{Counter: 3, Site: "bob"}, After: TextId{Counter: 1}, Char: "y"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ayx", edited.Text)
+
+	// A plain text change is merged as operations.
+	updated, err := r.UpdateItem(b.Id, created.Id, &Item{Text: "ayxz", TextDoc: &TextDoc{}})
+	assert.NoError(t, err)
+	assert.Equal(t, "ayxz", updated.TextDoc.text())
+	assert.Len(t, updated.TextDoc.Chars, 5)
+
+	// The board updates carry the operations merged since the version.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, 2)
+	assert.Equal(t, "ayxz", delta.Items[created.Id].Text)
+	if assert.Len(t, delta.TextOps[created.Id], 2) {
+		assert.EqualValues(t, 3, delta.TextOps[created.Id][0].Version)
+		assert.Equal(t, "z", delta.TextOps[created.Id][1].Char)
+	}
+
+	errorCases := []struct {
+		BoardId string
+		ItemId  string
+		Ops     []TextOp
+	}{
+		{BoardId: "not_existing_board_id", ItemId: created.Id, Ops: []TextOp{{Type: textDelete, Id: TextId{Counter: 1}}}},
+		{BoardId: b.Id, ItemId: "not_existing_item_id", Ops: []TextOp{{Type: textDelete, Id: TextId{Counter: 1}}}},
+		{BoardId: b.Id, ItemId: created.Id, Ops: nil},
+		{BoardId: b.Id, ItemId: created.Id, Ops: []TextOp{{Type: textInsert, Id: TextId{Counter: 9}, Char: "s"}}},
+		{BoardId: b.Id, ItemId: created.Id, Ops: []TextOp{
+			{Type: textDelete, Id: TextId{Counter: 1}},
+			{Type: textDelete, Id: TextId{Counter: 9, Site: "bob"}},
+		}},
+	}
+
+	for _, errorCase := range errorCases {
+		notFound, err := r.EditText(errorCase.BoardId, errorCase.ItemId, errorCase.Ops)
+		assert.Error(t, err)
+		assert.Nil(t, notFound)
+	}
+
+	// Failed batches change nothing.
+	result, _ := r.GetItem(b, created.Id)
+	assert.Equal(t, "ayxz", result.Text)
+	assert.EqualValues(t, 4, b.Version)
+}
+
+func TestRepoColumns(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+
+	wentWell, err := r.CreateColumn(b.Id, &Column{Title: "Went well", Color: "green", Order: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, wentWell.Order)
+	toImprove, _ := r.CreateColumn(b.Id, &Column{Title: "To improve", Color: "red"})
+	actions, _ := r.CreateColumn(b.Id, &Column{Title: "Actions", Color: "blue"})
+	assert.Equal(t, 2, actions.Order)
+
+	renamed, err := r.UpdateColumn(b.Id, toImprove.Id, &Column{Title: "Improve", Color: "orange"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Column{Id: toImprove.Id, Title: "Improve", Color: "orange", Order: 1}, renamed)
+
+	moved, err := r.MoveColumn(b.Id, actions.Id, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, moved.Order)
+	assert.Equal(t, []Column{
+		{Id: actions.Id, Title: "Actions", Color: "blue", Order: 0},
+		{Id: wentWell.Id, Title: "Went well", Color: "green", Order: 1},
+		{Id: toImprove.Id, Title: "Improve", Color: "orange", Order: 2},
+	}, b.Columns)
+
+	// Items are put in existing columns only.
+	item, err := r.CreateItem(b.Id, &Item{Text: "foo", ColumnId: wentWell.Id})
+	assert.NoError(t, err)
+	_, err = r.CreateItem(b.Id, &Item{Text: "bar", ColumnId: "not_existing_column_id"})
+	assert.Error(t, err)
+	_, err = r.PatchItem(b.Id, item.Id, []byte(`{"column_id": "not_existing_column_id"}`))
+	assert.Error(t, err)
+	assert.EqualValues(t, 6, b.Version)
+
+	// Column changes are in the board updates.
+	deleted, err := r.DeleteColumn(b.Id, wentWell.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Went well", deleted.Title)
+
+	delta, _ := r.GetBoardUpdates(context.Background(), b, 6)
+	assert.EqualValues(t, 7, delta.Version)
+	assert.Len(t, delta.Columns, 2)
+	assert.Equal(t, 1, delta.Columns[1].Order)
+	assert.Equal(t, "", delta.Items[item.Id].ColumnId)
+	assert.EqualValues(t, 7, delta.Items[item.Id].Version)
+
+	errorCases := []struct {
+		BoardId  string
+		ColumnId string
+		Order    int
+	}{
+		{BoardId: "not_existing_board_id", ColumnId: actions.Id},
+		{BoardId: b.Id, ColumnId: "not_existing_column_id"},
+		{BoardId: b.Id, ColumnId: actions.Id, Order: 2},
+		{BoardId: b.Id, ColumnId: actions.Id, Order: -1},
+	}
+
+	for _, errorCase := range errorCases {
+		notFound, err := r.MoveColumn(errorCase.BoardId, errorCase.ColumnId, errorCase.Order)
+		assert.Error(t, err)
+		assert.Nil(t, notFound)
+	}
+	_, err = r.UpdateColumn(b.Id, wentWell.Id, &Column{Title: "Went well"})
+	assert.Error(t, err)
+	_, err = r.DeleteColumn(b.Id, wentWell.Id)
+	assert.Error(t, err)
+	assert.EqualValues(t, 7, b.Version)
+}
+
+func TestRepoTemplates(t *testing.T) {
+	r := NewMemoryRepo()
+
+	b, err := r.CreateBoardFromTemplate("mad-sad-glad")
+	assert.NoError(t, err)
+	if assert.Len(t, b.Columns, 3) {
+		assert.Equal(t, "Sad", b.Columns[1].Title)
+		assert.Equal(t, "blue", b.Columns[1].Color)
+		assert.Equal(t, 1, b.Columns[1].Order)
+		assert.NotEmpty(t, b.Columns[1].Prompt)
+		assert.NotEmpty(t, b.Columns[1].Id)
+	}
+	assert.EqualValues(t, 0, b.Version)
+
+	// Custom templates are listed after the built-in ones.
+	saved, err := r.SaveTemplate(&Template{
+		Name:    "team",
+		Title:   "Team retro",
+		BuiltIn: true,
+		Columns: []Column{{Id: "column_id", Title: "Went well"}, {Title: "To improve"}},
+	})
+	assert.NoError(t, err)
+	assert.False(t, saved.BuiltIn)
+	assert.Equal(t, Column{Title: "To improve", Order: 1}, saved.Columns[1])
+
+	templates, _ := r.GetTemplates()
+	assert.Len(t, templates, len(builtinTemplates)+1)
+	assert.Equal(t, saved, templates[len(templates)-1])
+
+	b, err = r.CreateBoardFromTemplate("team")
+	assert.NoError(t, err)
+	assert.Len(t, b.Columns, 2)
+	assert.NotEqual(t, "column_id", b.Columns[0].Id)
+
+	// Built-in templates can't be changed.
+	_, err = r.SaveTemplate(&Template{Name: "starfish"})
+	assert.Error(t, err)
+	_, err = r.DeleteTemplate("starfish")
+	assert.Error(t, err)
+	_, err = r.SaveTemplate(&Template{})
+	assert.Error(t, err)
+
+	deleted, err := r.DeleteTemplate("team")
+	assert.NoError(t, err)
+	assert.Equal(t, saved, deleted)
+	_, err = r.DeleteTemplate("team")
+	assert.Error(t, err)
+	_, err = r.CreateBoardFromTemplate("team")
+	assert.Error(t, err)
+}
+
+func TestRepoChangeLogTrim(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	item, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	r.EditText(b.Id, item.Id, []TextOp{{Type: textInsert, Id: TextId{Counter: 4, Site: "alice"}, Char: "a"}})
+	version := b.Version
+
+	texts := []string{"bar", "baz"}
+	for i := 0; i < maxChanges; i++ {
+		r.UpdateItem(b.Id, item.Id, &Item{Text: texts[i%2]})
+	}
+
+	// The change log and the text operations only keep the later changes.
+	assert.LessOrEqual(t, len(b.changes), maxChanges)
+	assert.Greater(t, b.since, version)
+	for _, op := range b.Items[item.Id].TextDoc.ops {
+		assert.Greater(t, op.Version, b.since)
+	}
+
+	// Polls from before the log get the whole board.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	assert.True(t, delta.Full)
+	assert.Equal(t, "baz", delta.Items[item.Id].Text)
+	delta, _ = r.GetBoardUpdates(context.Background(), b, b.Version-1)
+	assert.False(t, delta.Full)
+	assert.Contains(t, delta.Items, item.Id)
+	assert.NotEmpty(t, delta.TextOps[item.Id])
+}
+
+func TestRepoVotes(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	first, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	second, _ := r.CreateItem(b.Id, &Item{Text: "bar"})
+
+	_, err := r.SetVoteBudget(b.Id, "", VoteBudget{Budget: 2})
+	assert.NoError(t, err)
+	_, err = r.SetVoteBudget(b.Id, "", VoteBudget{ParticipantId: "bob", Budget: 3})
+	assert.NoError(t, err)
+
+	voted, err := r.AddVote(b.Id, second.Id, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"alice": 1}, voted.Votes)
+	r.AddVote(b.Id, first.Id, "alice")
+
+	// The budget is across the board.
+	_, err = r.AddVote(b.Id, second.Id, "alice")
+	assert.ErrorIs(t, err, ErrVoteBudgetExceeded)
+	for i := 0; i < 3; i++ {
+		voted, err = r.AddVote(b.Id, second.Id, "bob")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]int{"alice": 1, "bob": 3}, voted.Votes)
+	_, err = r.AddVote(b.Id, second.Id, "bob")
+	assert.ErrorIs(t, err, ErrVoteBudgetExceeded)
+
+	// Votes are kept on updates.
+	updated, _ := r.UpdateItem(b.Id, first.Id, &Item{Text: "baz", Votes: map[string]int{"carol": 10}})
+	assert.Equal(t, map[string]int{"alice": 1}, updated.Votes)
+
+	// Taking back a vote frees the budget.
+	voted, err = r.RemoveVote(b.Id, first.Id, "alice")
+	assert.NoError(t, err)
+	assert.NotContains(t, voted.Votes, "alice")
+	_, err = r.RemoveVote(b.Id, first.Id, "alice")
+	assert.Error(t, err)
+	_, err = r.AddVote(b.Id, first.Id, "alice")
+	assert.NoError(t, err)
+
+	ranking, err := r.GetRanking(b.Id)
+	assert.NoError(t, err)
+	if assert.Len(t, ranking, 2) {
+		assert.Equal(t, second.Id, ranking[0].Id)
+		assert.Equal(t, 4, ranking[0].voteCount())
+	}
+
+	// Vote changes are in the board updates.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, b.Version-1)
+	assert.Equal(t, map[string]int{"alice": 1}, delta.Items[first.Id].Votes)
+
+	_, err = r.SetVoteBudget(b.Id, "", VoteBudget{Budget: -1})
+	assert.Error(t, err)
+	_, err = r.AddVote(b.Id, first.Id, "")
+	assert.Error(t, err)
+	_, err = r.GetRanking("not_existing_board_id")
+	assert.Error(t, err)
+}
+
+func TestRepoVoteBudgetConcurrent(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	r.SetVoteBudget(b.Id, "", VoteBudget{Budget: 3})
+
+	var items []*Item
+	for i := 0; i < 4; i++ {
+		it, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+		items = append(items, it)
+	}
+
+	// The budget holds however the votes are interleaved.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(it *Item) {
+			defer wg.Done()
+			r.AddVote(b.Id, it.Id, "alice")
+		}(items[i%len(items)])
+	}
+	wg.Wait()
+
+	ranking, _ := r.GetRanking(b.Id)
+	count := 0
+	for _, it := range ranking {
+		count += it.voteCount()
+	}
+	assert.Equal(t, 3, count)
+}
+
+func TestRepoHiddenVotes(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	item, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	r.SetVisibility(b.Id, "", Visibility{HideVotes: true})
+
+	version := b.Version
+	voted, err := r.AddVote(b.Id, item.Id, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"alice": 1}, voted.Votes)
+	r.AddVote(b.Id, item.Id, "alice")
+	r.AddVote(b.Id, item.Id, "carol")
+	_, err = r.RemoveVote(b.Id, item.Id, "carol")
+	assert.NoError(t, err)
+
+	// Hidden votes change no version.
+	assert.Equal(t, version, b.Version)
+	assert.Equal(t, item.Version, b.Items[item.Id].Version)
+
+	// The next update of another participant doesn't reveal the votes.
+	r.CreateItem(b.Id, &Item{Text: "bar"})
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	view := viewBoard(delta, "bob")
+	assert.Len(t, view.Items, 1)
+	assert.NotContains(t, view.Items, item.Id)
+
+	// The voter sees their own votes.
+	view = boardView(b, "alice")
+	assert.Equal(t, map[string]int{"alice": 2}, view.Items[item.Id].Votes)
+
+	// Revealing the votes sends the whole board.
+	version = b.Version
+	r.SetVisibility(b.Id, "", Visibility{})
+	delta, _ = r.GetBoardUpdates(context.Background(), b, version)
+	assert.True(t, delta.Full)
+	assert.Equal(t, map[string]int{"alice": 2}, viewBoard(delta, "bob").Items[item.Id].Votes)
+}
+
+func TestRepoFacilitator(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+
+	// Anyone runs a board without a facilitator.
+	_, err := r.SetVisibility(b.Id, "", Visibility{HideVotes: true})
+	assert.NoError(t, err)
+	_, err = r.SetFacilitator(b.Id, "alice", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", b.Facilitator)
+
+	_, err = r.SetFacilitator(b.Id, "bob", "bob")
+	assert.ErrorIs(t, err, ErrNotFacilitator)
+	_, err = r.SetVisibility(b.Id, "bob", Visibility{})
+	assert.ErrorIs(t, err, ErrNotFacilitator)
+	_, err = r.SetVoteBudget(b.Id, "bob", VoteBudget{ParticipantId: "bob", Budget: 10})
+	assert.ErrorIs(t, err, ErrNotFacilitator)
+	_, err = r.SetFacilitator(b.Id, "alice", "")
+	assert.Error(t, err)
+
+	// The facilitator hands the role over.
+	_, err = r.SetFacilitator(b.Id, "alice", "bob")
+	assert.NoError(t, err)
+	_, err = r.SetVisibility(b.Id, "bob", Visibility{HideCards: true})
+	assert.NoError(t, err)
+	assert.Equal(t, Visibility{HideCards: true}, b.Visibility)
+
+	// Items keep their author.
+	created, _ := r.CreateItem(b.Id, &Item{Text: "foo", Author: "alice", Hidden: true})
+	assert.False(t, created.Hidden)
+	updated, _ := r.UpdateItem(b.Id, created.Id, &Item{Text: "bar", Author: "bob"})
+	assert.Equal(t, "alice", updated.Author)
+}
+
+func TestRepoPhases(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	r.SetFacilitator(b.Id, "alice", "alice")
+
+	// Boards without a phase allow everything.
+	item, err := r.CreateItem(b.Id, &Item{Text: "foo"})
+	assert.NoError(t, err)
+
+	_, err = r.SetPhase(b.Id, "bob", "")
+	assert.ErrorIs(t, err, ErrNotFacilitator)
+	_, err = r.SetPhase(b.Id, "alice", "unknown")
+	assert.Error(t, err)
+
+	_, err = r.SetPhase(b.Id, "alice", "")
+	assert.NoError(t, err)
+	assert.Equal(t, phaseSetup, b.Phase)
+	_, err = r.CreateItem(b.Id, &Item{Text: "bar"})
+	assert.ErrorIs(t, err, ErrPhase)
+	_, err = r.CreateColumn(b.Id, &Column{Title: "Went well"})
+	assert.NoError(t, err)
+
+	// No votes while brainstorming.
+	r.SetPhase(b.Id, "alice", "")
+	assert.Equal(t, phaseBrainstorm, b.Phase)
+	_, err = r.AddVote(b.Id, item.Id, "bob")
+	assert.ErrorIs(t, err, ErrPhase)
+	_, err = r.UpdateItem(b.Id, item.Id, &Item{Text: "baz"})
+	assert.NoError(t, err)
+
+	// No new items while voting.
+	_, err = r.SetPhase(b.Id, "alice", phaseVote)
+	assert.NoError(t, err)
+	_, err = r.CreateItem(b.Id, &Item{Text: "bar"})
+	assert.ErrorIs(t, err, ErrPhase)
+	_, err = r.PatchItem(b.Id, item.Id, []byte(`{"text": "qux"}`))
+	assert.ErrorIs(t, err, ErrPhase)
+	_, err = r.AddVote(b.Id, item.Id, "bob")
+	assert.NoError(t, err)
+
+	// Phase changes are in the board updates.
+	version := b.Version
+	r.SetPhase(b.Id, "alice", phaseClosed)
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	assert.Equal(t, phaseClosed, delta.Phase)
+
+	_, err = r.SetPhase(b.Id, "alice", "")
+	assert.Error(t, err)
+	_, err = r.RemoveVote(b.Id, item.Id, "bob")
+	assert.ErrorIs(t, err, ErrPhase)
+}
+
+func TestRepoTimer(t *testing.T) {
+	r := NewMemoryRepo()
+	defer r.Close()
+	b, _ := r.CreateBoard()
+	r.SetFacilitator(b.Id, "alice", "alice")
+
+	_, err := r.ControlTimer(b.Id, "bob", &TimerRequest{Action: "start", Duration: 60})
+	assert.ErrorIs(t, err, ErrNotFacilitator)
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "pause"})
+	assert.Error(t, err)
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "start"})
+	assert.Error(t, err)
+
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "start", Duration: 60})
+	assert.NoError(t, err)
+	assert.True(t, b.Timer.Running)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *b.Timer.EndsAt, time.Second)
+
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "pause"})
+	assert.NoError(t, err)
+	assert.False(t, b.Timer.Running)
+	assert.Nil(t, b.Timer.EndsAt)
+	assert.InDelta(t, 60, b.Timer.Remaining, 1)
+
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "extend", Duration: 30})
+	assert.NoError(t, err)
+	assert.InDelta(t, 90, b.Timer.Remaining, 1)
+	assert.Equal(t, 90.0, b.Timer.Duration)
+
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "resume"})
+	assert.NoError(t, err)
+	assert.True(t, b.Timer.Running)
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "resume"})
+	assert.Error(t, err)
+
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "reset"})
+	assert.NoError(t, err)
+	assert.False(t, b.Timer.Running)
+	assert.Equal(t, 90.0, b.Timer.Remaining)
+
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "rewind"})
+	assert.Error(t, err)
+}
+
+func TestRepoTimerExpiry(t *testing.T) {
+	r := NewMemoryRepo()
+	defer r.Close()
+	b, _ := r.CreateBoard()
+	r.SetFacilitator(b.Id, "alice", "alice")
+	r.SetPhase(b.Id, "alice", phaseBrainstorm)
+
+	_, err := r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "start", Duration: 0.05, AdvancePhase: true})
+	assert.NoError(t, err)
+
+	// The expiry is in the board updates.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	delta, err := r.GetBoardUpdates(ctx, b, b.Version)
+	assert.NoError(t, err)
+	assert.True(t, delta.Timer.Expired)
+	assert.False(t, delta.Timer.Running)
+	assert.Equal(t, phaseGroup, delta.Phase)
+
+	// Expired timers run again when extended.
+	_, err = r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "extend", Duration: 60})
+	assert.NoError(t, err)
+	assert.True(t, b.Timer.Running)
+	assert.False(t, b.Timer.Expired)
+}
+
+func TestRepoTimerArchived(t *testing.T) {
+	r := NewMemoryRepo()
+	defer r.Close()
+	b, _ := r.CreateBoard()
+	r.SetFacilitator(b.Id, "alice", "alice")
+	r.SetPhase(b.Id, "alice", phaseBrainstorm)
+
+	_, err := r.ControlTimer(b.Id, "alice", &TimerRequest{Action: "start", Duration: 0.05, AdvancePhase: true})
+	assert.NoError(t, err)
+	_, err = r.ArchiveBoard(b.Id)
+	assert.NoError(t, err)
+	version := b.Version
+
+	// The timer of an archived board doesn't run out.
+	time.Sleep(150 * time.Millisecond)
+	b, _ = r.GetBoard(b.Id)
+	assert.Equal(t, version, b.Version)
+	assert.False(t, b.Timer.Running)
+	assert.False(t, b.Timer.Expired)
+	assert.Equal(t, phaseBrainstorm, b.Phase)
+}
+
+func TestRepoGroups(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	first, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	second, _ := r.CreateItem(b.Id, &Item{Text: "bar"})
+
+	_, err := r.CreateGroup(b.Id, &Group{Items: []string{"unknown"}})
+	assert.Error(t, err)
+
+	version := b.Version
+	group, err := r.CreateGroup(b.Id, &Group{Title: "Tooling", Items: []string{first.Id, second.Id}, Width: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, b.Version, group.Version)
+
+	// Group changes are in the board updates.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	assert.Len(t, delta.Groups, 1)
+	assert.Contains(t, delta.Groups, group.Id)
+	assert.Empty(t, delta.Items)
+
+	// Moving an item takes it out of its group.
+	other, err := r.CreateGroup(b.Id, &Group{Title: "Process"})
+	assert.NoError(t, err)
+	version = b.Version
+	other, err = r.GroupItem(b.Id, other.Id, second.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{second.Id}, other.Items)
+	assert.Equal(t, []string{first.Id}, b.Groups[group.Id].Items)
+	delta, _ = r.GetBoardUpdates(context.Background(), b, version)
+	assert.Len(t, delta.Groups, 2)
+
+	_, err = r.UngroupItem(b.Id, group.Id, second.Id)
+	assert.Error(t, err)
+	other, err = r.UngroupItem(b.Id, other.Id, second.Id)
+	assert.NoError(t, err)
+	assert.Empty(t, other.Items)
+
+	updated, err := r.UpdateGroup(b.Id, group.Id, &Group{Title: "Tools", Left: 10, Items: []string{second.Id}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Tools", updated.Title)
+	assert.Equal(t, []string{first.Id}, updated.Items)
+
+	// Votes on the items add up in the group.
+	r.GroupItem(b.Id, group.Id, second.Id)
+	r.AddVote(b.Id, first.Id, "alice")
+	r.AddVote(b.Id, second.Id, "alice")
+	version = b.Version
+	r.AddVote(b.Id, second.Id, "bob")
+	delta, _ = r.GetBoardUpdates(context.Background(), b, version)
+	assert.Equal(t, map[string]int{"alice": 2, "bob": 1}, delta.Groups[group.Id].Votes)
+	updated, err = r.UpdateGroup(b.Id, group.Id, &Group{Title: "Tools"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"alice": 2, "bob": 1}, updated.Votes)
+
+	// Deleted items leave their group.
+	r.DeleteItem(b.Id, second.Id)
+	assert.Equal(t, []string{first.Id}, b.Groups[group.Id].Items)
+
+	// Dissolved groups are tombstones in the board updates.
+	version = b.Version
+	dissolved, err := r.DissolveGroup(b.Id, group.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"alice": 1}, dissolved.Votes)
+	assert.NotContains(t, b.Groups, group.Id)
+	assert.Contains(t, b.Items, first.Id)
+	delta, _ = r.GetBoardUpdates(context.Background(), b, version)
+	assert.Equal(t, []string{group.Id}, delta.DeletedGroups)
+
+	_, err = r.DissolveGroup(b.Id, group.Id)
+	assert.Error(t, err)
+}
+
+func TestRepoActions(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	item, _ := r.CreateItem(b.Id, &Item{Text: "CI is slow"})
+
+	_, err := r.CreateAction(b.Id, &Action{Title: "Fix CI", Status: "later"})
+	assert.Error(t, err)
+	_, err = r.CreateAction(b.Id, &Action{Title: "Fix CI", DueDate: "tomorrow"})
+	assert.Error(t, err)
+	_, err = r.CreateAction(b.Id, &Action{Title: "Fix CI", ItemId: "unknown"})
+	assert.Error(t, err)
+
+	version := b.Version
+	action, err := r.CreateAction(b.Id, &Action{Title: "Fix CI", Assignee: "alice", DueDate: "2020-01-31", ItemId: item.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "open", action.Status)
+	assert.Equal(t, b.Version, action.Version)
+
+	// Action changes are in the board updates.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	assert.Equal(t, map[string]*Action{action.Id: action}, delta.Actions)
+
+	done, err := r.CreateAction(b.Id, &Action{Title: "Write docs"})
+	assert.NoError(t, err)
+	done, err = r.UpdateAction(b.Id, done.Id, &Action{Title: "Write docs", Status: "done"})
+	assert.NoError(t, err)
+	assert.Equal(t, "done", done.Status)
+	dropped, _ := r.CreateAction(b.Id, &Action{Title: "Rewrite it"})
+	_, err = r.DeleteAction(b.Id, dropped.Id)
+	assert.NoError(t, err)
+	_, err = r.DeleteAction(b.Id, dropped.Id)
+	assert.Error(t, err)
+
+	// Deleted cards are unlinked from their actions.
+	version = b.Version
+	r.DeleteItem(b.Id, item.Id)
+	assert.Empty(t, b.Actions[action.Id].ItemId)
+	delta, _ = r.GetBoardUpdates(context.Background(), b, version)
+	assert.Contains(t, delta.Actions, action.Id)
+
+	// Only the open actions are carried over.
+	next, _ := r.CreateBoard()
+	_, err = r.CarryOverActions(next.Id, "unknown")
+	assert.Error(t, err)
+	_, err = r.CarryOverActions(next.Id, b.Id)
+	assert.NoError(t, err)
+	if assert.Len(t, next.Actions, 1) {
+		for _, carried := range next.Actions {
+			assert.NotEqual(t, action.Id, carried.Id)
+			assert.Equal(t, "Fix CI", carried.Title)
+			assert.Equal(t, b.Id, carried.CarriedFrom)
+		}
+	}
+
+	// Actions carried again keep the board they came from.
+	last, _ := r.CreateBoard()
+	r.CarryOverActions(last.Id, next.Id)
+	for _, carried := range last.Actions {
+		assert.Equal(t, b.Id, carried.CarriedFrom)
+	}
+}
+
+func TestRepoComments(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	item, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+
+	_, err := r.AddComment(b.Id, item.Id, &Comment{Author: "alice"})
+	assert.Error(t, err)
+	_, err = r.AddComment(b.Id, "unknown", &Comment{Author: "alice", Text: "Agreed"})
+	assert.Error(t, err)
+
+	version := b.Version
+	comment, err := r.AddComment(b.Id, item.Id, &Comment{Author: "alice", Text: "Agreed"})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", comment.Author)
+	assert.False(t, comment.CreatedAt.IsZero())
+
+	// Comments come with their item in the board updates.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	assert.Equal(t, []Comment{*comment}, delta.Items[item.Id].Comments)
+
+	// Only the author changes a comment.
+	_, err = r.EditComment(b.Id, item.Id, comment.Id, &Comment{Author: "bob", Text: "Disagreed"})
+	assert.ErrorIs(t, err, ErrNotAuthor)
+	edited, err := r.EditComment(b.Id, item.Id, comment.Id, &Comment{Author: "alice", Text: "Strongly agreed"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Strongly agreed", edited.Text)
+	assert.NotNil(t, edited.UpdatedAt)
+
+	// Item updates keep the comments.
+	r.UpdateItem(b.Id, item.Id, &Item{Text: "bar"})
+	r.PatchItem(b.Id, item.Id, []byte(`{"comments": null}`))
+	assert.Len(t, b.Items[item.Id].Comments, 1)
+
+	_, err = r.DeleteComment(b.Id, item.Id, comment.Id, "bob")
+	assert.ErrorIs(t, err, ErrNotAuthor)
+	_, err = r.DeleteComment(b.Id, item.Id, comment.Id, "alice")
+	assert.NoError(t, err)
+	assert.Empty(t, b.Items[item.Id].Comments)
+	_, err = r.DeleteComment(b.Id, item.Id, comment.Id, "alice")
+	assert.Error(t, err)
+}
+
+func TestRepoReactions(t *testing.T) {
+	r := NewMemoryRepo()
+	b, _ := r.CreateBoard()
+	item, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+
+	for _, emoji := range []string{"", "+1", "👍 ", strings.Repeat("👍", 10)} {
+		_, err := r.ToggleReaction(b.Id, item.Id, "alice", emoji)
+		assert.Error(t, err, emoji)
+	}
+	_, err := r.ToggleReaction(b.Id, item.Id, "", "👍")
+	assert.Error(t, err)
+
+	version := b.Version
+	_, err = r.ToggleReaction(b.Id, item.Id, "alice", "👍")
+	assert.NoError(t, err)
+	reacted, err := r.ToggleReaction(b.Id, item.Id, "bob", "👍")
+	assert.NoError(t, err)
+	assert.Equal(t, &Reaction{Count: 2, By: []string{"alice", "bob"}}, reacted.Reactions["👍"])
+
+	// Reactions come with their item in the board updates.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	assert.Equal(t, 2, delta.Items[item.Id].Reactions["👍"].Count)
+
+	// Reactions are separate from votes and kept on updates.
+	assert.Empty(t, b.Items[item.Id].Votes)
+	r.UpdateItem(b.Id, item.Id, &Item{Text: "bar"})
+	assert.Equal(t, 2, b.Items[item.Id].Reactions["👍"].Count)
+
+	// Toggling again takes the reaction back.
+	reacted, _ = r.ToggleReaction(b.Id, item.Id, "alice", "👍")
+	assert.Equal(t, &Reaction{Count: 1, By: []string{"bob"}}, reacted.Reactions["👍"])
+	reacted, _ = r.ToggleReaction(b.Id, item.Id, "bob", "👍")
+	assert.Empty(t, reacted.Reactions)
+}
+
+func TestRepoPresence(t *testing.T) {
+	r := NewMemoryRepo()
+	defer r.Close()
+	r.(*memoryRepo).presenceTimeout = 50 * time.Millisecond
+	b, _ := r.CreateBoard()
+
+	_, err := r.Join(b.Id, &Participant{Name: "Alice"})
+	assert.Error(t, err)
+
+	version := b.Version
+	alice, err := r.Join(b.Id, &Participant{Id: "alice", Name: "Alice", Color: "#ff8800"})
+	assert.NoError(t, err)
+	assert.True(t, alice.Online)
+
+	// Presence changes are in the board updates.
+	delta, _ := r.GetBoardUpdates(context.Background(), b, version)
+	assert.Equal(t, alice, delta.Participants["alice"])
+
+	// Heartbeats of participants who haven't joined add them.
+	assert.NoError(t, r.Heartbeat(b.Id, "bob"))
+	version = b.Version
+	assert.NoError(t, r.Heartbeat(b.Id, "bob"))
+	assert.Equal(t, version, b.Version)
+
+	participants, err := r.GetParticipants(b.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Participant{{Id: "bob", Online: true}, alice}, participants)
+
+	bob, err := r.Leave(b.Id, "bob")
+	assert.NoError(t, err)
+	assert.False(t, bob.Online)
+	_, err = r.Leave(b.Id, "carol")
+	assert.Error(t, err)
+
+	// Participants go offline without heartbeats.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	delta, err = r.GetBoardUpdates(ctx, b, b.Version)
+	assert.NoError(t, err)
+	assert.False(t, delta.Participants["alice"].Online)
+
+	// Archived boards don't track presence.
+	r.Heartbeat(b.Id, "bob")
+	_, err = r.ArchiveBoard(b.Id)
+	assert.NoError(t, err)
+	assert.False(t, b.Participants["bob"].Online)
+	version = b.Version
+	_, err = r.Join(b.Id, &Participant{Id: "alice", Name: "Alice"})
+	assert.ErrorIs(t, err, ErrBoardArchived)
+	assert.ErrorIs(t, r.Heartbeat(b.Id, "alice"), ErrBoardArchived)
+	_, err = r.Leave(b.Id, "bob")
+	assert.ErrorIs(t, err, ErrBoardArchived)
+	assert.Equal(t, version, b.Version)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Socket message types.
+const (
+	// Sent by the server.
+	msgBoard = "board"
+	msgItem  = "item"
+	msgError = "error"
+
+	// Sent by the client, relayed by the server to the other clients.
+	msgCursor = "cursor"
+
+	// Sent by the client.
+	msgCreateItem = "create_item"
+	msgUpdateItem = "update_item"
+	msgPatchItem  = "patch_item"
+	msgDeleteItem = "delete_item"
+	msgEditText   = "edit_text"
+)
+
+const (
+	// socketWriteWait is the time allowed to write a message.
+	socketWriteWait = 10 * time.Second
+	// socketPongWait is the time allowed to read the next pong.
+	socketPongWait = 60 * time.Second
+	// socketPingPeriod must be less than socketPongWait.
+	socketPingPeriod = socketPongWait * 9 / 10
+	// socketReadLimit is the largest message accepted from a client, the
+	// connection is closed on a larger one.
+	socketReadLimit = 64 << 10
+)
+
+var upgrader = websocket.Upgrader{}
+
+// boardSocket streams the changes in specified board id over a web socket
+// and accepts item commands from the client.
+// Sends the whole board first, unless a version query parameter is given,
+// then a board object with the changed items on every update. The client
+// sees the board as the participant connecting. Cursor messages are relayed
+// to the other clients of the board without changing it.
+func (h *handler) boardSocket(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["board-id"]
+	viewer, _ := participantId(r)
+
+	b, err := h.repo.GetBoard(id)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, err)
+		return
+	}
+
+	// Start from the given version, if any.
+	var version uint64
+	sendBoard := true
+	if sVersion := r.URL.Query().Get("version"); sVersion != "" {
+		version, err = strconv.ParseUint(sVersion, 10, 64)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, errors.New("invalid_argument_version"))
+			return
+		}
+		sendBoard = false
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied.
+		return
+	}
+	defer conn.Close()
+
+	// A client that doesn't answer the pings is gone.
+	conn.SetReadLimit(socketReadLimit)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	// The participant is online while connected.
+	defer h.keepPresent(r, id)()
+
+	s := &socket{conn: conn, participant: viewer, cursors: make(chan SocketMessage, cursorBuffer)}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	h.cursors.join(b.Id, s)
+	defer h.cursors.leave(b.Id, s)
+	defer s.stopCursor()
+
+	if sendBoard {
+		view := boardView(b, viewer)
+		version = view.Version
+		if err := s.send(SocketMessage{Type: msgBoard, Board: view}); err != nil {
+			return
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Closing the connection stops the reader.
+		defer conn.Close()
+		h.writeBoardUpdates(ctx, s, b, version)
+	}()
+
+	h.readCommands(s, b)
+
+	cancel()
+	wg.Wait()
+}
+
+// writeBoardUpdates sends the board updates until the context is done
+// or the board is deleted.
+func (h *handler) writeBoardUpdates(ctx context.Context, s *socket, b *Board, version uint64) {
+	updates := make(chan *Board)
+	var pollErr error
+	go func() {
+		defer close(updates)
+		for {
+			delta, err := h.repo.GetBoardUpdates(ctx, b, version)
+			if err != nil {
+				pollErr = err
+				return
+			}
+			version = delta.Version
+
+			select {
+			case updates <- delta:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case delta, ok := <-updates:
+			if !ok {
+				if errors.Is(pollErr, ErrBoardDeleted) {
+					s.send(SocketMessage{Type: msgError, Error: pollErr.Error()})
+				}
+				return
+			}
+			delta = viewBoard(delta, s.participant)
+			if err := s.send(SocketMessage{Type: msgBoard, Board: delta}); err != nil {
+				return
+			}
+		case msg := <-s.cursors:
+			if err := s.send(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := s.ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommands handles the client commands until the connection fails.
+func (h *handler) readCommands(s *socket, b *Board) {
+	for {
+		msg := SocketMessage{}
+		err := s.conn.ReadJSON(&msg)
+
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			// Malformed message, the connection is still usable.
+			err = s.send(SocketMessage{Type: msgError, Error: "Parse error"})
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		// Cursors are relayed without a reply.
+		if msg.Type == msgCursor {
+			if reply := h.handleCursor(b, s, &msg); reply != nil {
+				if err := s.send(*reply); err != nil {
+					return
+				}
+			}
+			continue
+		}
+
+		reply := h.handleCommand(b, s.participant, &msg)
+		if err := s.send(reply); err != nil {
+			return
+		}
+	}
+}
+
+// handleCommand runs a command of a participant and returns the reply.
+func (h *handler) handleCommand(b *Board, participant string, msg *SocketMessage) SocketMessage {
+	switch {
+	case msg.Type == msgPatchItem && msg.Patch == nil,
+		msg.Type == msgEditText && msg.Ops == nil,
+		(msg.Type == msgCreateItem || msg.Type == msgUpdateItem) && msg.Item == nil:
+		return SocketMessage{Type: msgError, Error: "Missing input error"}
+	}
+
+	var item *Item
+	var err error
+
+	switch msg.Type {
+	case msgCreateItem:
+		msg.Item.Author = participant
+		item, err = h.repo.CreateItem(b.Id, msg.Item)
+	case msgUpdateItem:
+		item, err = h.repo.UpdateItem(b.Id, msg.Id, msg.Item)
+	case msgPatchItem:
+		item, err = h.repo.PatchItem(b.Id, msg.Id, msg.Patch)
+	case msgDeleteItem:
+		item, err = h.repo.DeleteItem(b.Id, msg.Id)
+	case msgEditText:
+		item, err = h.repo.EditText(b.Id, msg.Id, msg.Ops)
+	default:
+		err = errors.New("unknown_message_type")
+	}
+
+	if err != nil {
+		reply := SocketMessage{Type: msgError, Id: msg.Id, Error: err.Error()}
+
+		// A version conflict comes with the current item.
+		var conflict *ConflictError
+		if errors.As(err, &conflict) {
+			reply.Item = itemView(b, conflict.Item, participant)
+		}
+		return reply
+	}
+	return SocketMessage{Type: msgItem, Id: item.Id, Item: itemView(b, item, participant)}
+}
+
+// socket serializes the writes to a web socket connection.
+type socket struct {
+	mutex sync.Mutex
+	conn  *websocket.Conn
+	// participant is the participant connected.
+	participant string
+	// cursors are the cursors of the others waiting to be sent.
+	cursors chan SocketMessage
+
+	cursorMutex sync.Mutex
+	// lastCursor is when a cursor of the client was last relayed.
+	lastCursor time.Time
+	// pendingCursor is the latest cursor of the client waiting for
+	// cursorTimer to relay it.
+	pendingCursor *Cursor
+	cursorTimer   *time.Timer
+}
+
+// send writes a message to the socket.
+func (s *socket) send(msg SocketMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return s.conn.WriteJSON(msg)
+}
+
+// ping writes a ping control message to the socket.
+func (s *socket) ping() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return s.conn.WriteMessage(websocket.PingMessage, nil)
+}
@@ -0,0 +1,65 @@
+package main
+
+// Store persists the boards of a repo.
+// The repo keeps the boards in memory and writes every change through
+// to the store before applying it.
+type Store interface {
+	// Load reads all the stored boards with their items.
+	Load() ([]*Board, error)
+	// CreateBoard stores a new board.
+	CreateBoard(b *Board) error
+	// UpdateBoard stores a new board version and state.
+	UpdateBoard(boardId string, version uint64, state *BoardState) error
+	// DeleteBoard removes a board with its items.
+	DeleteBoard(boardId string) error
+	// CreateItem stores a new item. The board version becomes the item version.
+	CreateItem(boardId string, it *Item) error
+	// UpdateItem stores an existing item. The board version becomes the item version.
+	UpdateItem(boardId string, it *Item) error
+	// DeleteItem removes an item and stores the new board version.
+	DeleteItem(boardId string, itemId string, version uint64) error
+	// UpdateBoardItems stores a board version and state together with the
+	// items changed and deleted, all or nothing. The items keep their versions.
+	UpdateBoardItems(boardId string, version uint64, state *BoardState, items []*Item, deletedIds []string) error
+	// LoadTemplates reads the custom templates. Called after Load.
+	LoadTemplates() ([]*Template, error)
+	// SaveTemplate stores a custom template in place of the one with its name.
+	SaveTemplate(t *Template) error
+	// DeleteTemplate removes a custom template.
+	DeleteTemplate(name string) error
+	// Close releases the store.
+	Close() error
+}
+
+// snapshotStore is a store which can compact its history into a snapshot.
+type snapshotStore interface {
+	Store
+	// Snapshot stores the boards and templates as they are. The boards
+	// and templates are locked by the caller.
+	Snapshot(boards []*Board, templates []*Template) error
+}
+
+// storedItem is the stored form of an item, with its version.
+type storedItem struct {
+	Version uint64 `json:"version"`
+	Item    *Item  `json:"item"`
+}
+
+// nopStore doesn't persist anything.
+type nopStore struct{}
+
+func (nopStore) Load() ([]*Board, error)                                    { return nil, nil }
+func (nopStore) CreateBoard(b *Board) error                                 { return nil }
+func (nopStore) UpdateBoard(boardId string, v uint64, st *BoardState) error { return nil }
+func (nopStore) DeleteBoard(boardId string) error                           { return nil }
+func (nopStore) CreateItem(boardId string, it *Item) error                  { return nil }
+func (nopStore) UpdateItem(boardId string, it *Item) error                  { return nil }
+func (nopStore) DeleteItem(boardId string, itemId string, v uint64) error   { return nil }
+func (nopStore) LoadTemplates() ([]*Template, error)                        { return nil, nil }
+func (nopStore) SaveTemplate(t *Template) error                             { return nil }
+func (nopStore) DeleteTemplate(name string) error                           { return nil }
+func (nopStore) Close() error                                               { return nil }
+
+func (nopStore) UpdateBoardItems(boardId string, v uint64, st *BoardState, items []*Item, ids []string) error {
+	return nil
+}
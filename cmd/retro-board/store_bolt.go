@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Keys in a board bucket.
+var (
+	boltVersionKey = []byte("version")
+	boltStateKey   = []byte("state")
+	boltItemsKey   = []byte("items")
+)
+
+// boltTemplatesBucket holds the custom templates by name. Board buckets
+// are named by their uuid, so it doesn't clash with them.
+var boltTemplatesBucket = []byte("templates")
+
+// boltStore stores boards in a bbolt file, one bucket per board.
+// A board bucket holds the board version, the board state as JSON and
+// a nested bucket of items.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltRepo opens or creates the bbolt file at path and loads its boards.
+func NewBoltRepo(path string) (Repo, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &boltStore{db: db}
+	r, err := newStoreRepo(s)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Load reads all the boards with their items.
+func (s *boltStore) Load() ([]*Board, error) {
+	var boards []*Board
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bb *bolt.Bucket) error {
+			if string(name) == string(boltTemplatesBucket) {
+				return nil
+			}
+
+			b := newBoard(string(name))
+			b.Version = decodeVersion(bb.Get(boltVersionKey))
+			if state := bb.Get(boltStateKey); state != nil {
+				if err := json.Unmarshal(state, &b.BoardState); err != nil {
+					return err
+				}
+			}
+
+			items := bb.Bucket(boltItemsKey)
+			err := items.ForEach(func(k, v []byte) error {
+				stored := storedItem{}
+				if err := json.Unmarshal(v, &stored); err != nil {
+					return err
+				}
+				stored.Item.Version = stored.Version
+				b.Items[stored.Item.Id] = stored.Item
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			boards = append(boards, b)
+			return nil
+		})
+	})
+
+	return boards, err
+}
+
+// CreateBoard creates the board bucket.
+func (s *boltStore) CreateBoard(b *Board) error {
+	state, err := json.Marshal(b.BoardState.stored())
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bb, err := tx.CreateBucket([]byte(b.Id))
+		if err != nil {
+			return err
+		}
+		if _, err := bb.CreateBucket(boltItemsKey); err != nil {
+			return err
+		}
+		if err := bb.Put(boltStateKey, state); err != nil {
+			return err
+		}
+		return bb.Put(boltVersionKey, encodeVersion(b.Version))
+	})
+}
+
+// UpdateBoard updates the board version and state.
+func (s *boltStore) UpdateBoard(boardId string, version uint64, state *BoardState) error {
+	data, err := json.Marshal(state.stored())
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bb, err := boardBucket(tx, boardId)
+		if err != nil {
+			return err
+		}
+		if err := bb.Put(boltStateKey, data); err != nil {
+			return err
+		}
+		return bb.Put(boltVersionKey, encodeVersion(version))
+	})
+}
+
+// DeleteBoard deletes the board bucket.
+func (s *boltStore) DeleteBoard(boardId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(boardId))
+	})
+}
+
+// CreateItem puts a new item and updates the board version.
+func (s *boltStore) CreateItem(boardId string, it *Item) error {
+	return s.putItem(boardId, it)
+}
+
+// UpdateItem puts an existing item and updates the board version.
+func (s *boltStore) UpdateItem(boardId string, it *Item) error {
+	return s.putItem(boardId, it)
+}
+
+// putItem writes an item and the board version in one transaction.
+func (s *boltStore) putItem(boardId string, it *Item) error {
+	data, err := json.Marshal(storedItem{Version: it.Version, Item: it})
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bb, err := boardBucket(tx, boardId)
+		if err != nil {
+			return err
+		}
+		if err := bb.Bucket(boltItemsKey).Put([]byte(it.Id), data); err != nil {
+			return err
+		}
+		return bb.Put(boltVersionKey, encodeVersion(it.Version))
+	})
+}
+
+// DeleteItem deletes an item and updates the board version.
+func (s *boltStore) DeleteItem(boardId string, itemId string, version uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bb, err := boardBucket(tx, boardId)
+		if err != nil {
+			return err
+		}
+		if err := bb.Bucket(boltItemsKey).Delete([]byte(itemId)); err != nil {
+			return err
+		}
+		return bb.Put(boltVersionKey, encodeVersion(version))
+	})
+}
+
+// UpdateBoardItems puts the changed items, deletes the deleted ones and
+// updates the board version and state in one transaction.
+func (s *boltStore) UpdateBoardItems(boardId string, version uint64, state *BoardState, items []*Item, deletedIds []string) error {
+	data, err := json.Marshal(state.stored())
+	if err != nil {
+		return err
+	}
+	itemData := make([][]byte, len(items))
+	for i, it := range items {
+		if itemData[i], err = json.Marshal(storedItem{Version: it.Version, Item: it}); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bb, err := boardBucket(tx, boardId)
+		if err != nil {
+			return err
+		}
+		ib := bb.Bucket(boltItemsKey)
+		for i, it := range items {
+			if err := ib.Put([]byte(it.Id), itemData[i]); err != nil {
+				return err
+			}
+		}
+		for _, id := range deletedIds {
+			if err := ib.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		if err := bb.Put(boltStateKey, data); err != nil {
+			return err
+		}
+		return bb.Put(boltVersionKey, encodeVersion(version))
+	})
+}
+
+// LoadTemplates reads the custom templates.
+func (s *boltStore) LoadTemplates() ([]*Template, error) {
+	var templates []*Template
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		tb := tx.Bucket(boltTemplatesBucket)
+		if tb == nil {
+			return nil
+		}
+		return tb.ForEach(func(k, v []byte) error {
+			t := &Template{}
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+			templates = append(templates, t)
+			return nil
+		})
+	})
+
+	return templates, err
+}
+
+// SaveTemplate puts a custom template.
+func (s *boltStore) SaveTemplate(t *Template) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		tb, err := tx.CreateBucketIfNotExists(boltTemplatesBucket)
+		if err != nil {
+			return err
+		}
+		return tb.Put([]byte(t.Name), data)
+	})
+}
+
+// DeleteTemplate deletes a custom template.
+func (s *boltStore) DeleteTemplate(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		tb := tx.Bucket(boltTemplatesBucket)
+		if tb == nil {
+			return nil
+		}
+		return tb.Delete([]byte(name))
+	})
+}
+
+// Close closes the file.
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// boardBucket gets the bucket of a board.
+func boardBucket(tx *bolt.Tx, boardId string) (*bolt.Bucket, error) {
+	bb := tx.Bucket([]byte(boardId))
+	if bb == nil {
+		return nil, errors.New("board_not_found")
+	}
+	return bb, nil
+}
+
+func encodeVersion(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
+
+func decodeVersion(buf []byte) uint64 {
+	if len(buf) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(buf)
+}
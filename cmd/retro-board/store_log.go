@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event log event types.
+const (
+	eventCreateBoard = "create_board"
+	eventUpdateBoard = "update_board"
+	eventDeleteBoard = "delete_board"
+	eventCreateItem  = "create_item"
+	eventUpdateItem  = "update_item"
+	eventDeleteItem  = "delete_item"
+	// eventUpdateBoardItems changes the state and several items at once.
+	eventUpdateBoardItems = "update_board_items"
+
+	eventSaveTemplate   = "save_template"
+	eventDeleteTemplate = "delete_template"
+)
+
+// maxRecordSize bounds the payload of a log record, so that a corrupt
+// length can't make the load allocate gigabytes.
+const maxRecordSize = 32 << 20
+
+// logEvent is a change recorded in the event log.
+type logEvent struct {
+	Type    string      `json:"type"`
+	Time    time.Time   `json:"time"`
+	BoardId string      `json:"board_id"`
+	Version uint64      `json:"version"`
+	State   *BoardState `json:"state,omitempty"`
+	Item    *Item       `json:"item,omitempty"`
+	ItemId  string      `json:"item_id,omitempty"`
+	// Items and DeletedIds are the items changed and deleted at once.
+	Items      []*Item  `json:"items,omitempty"`
+	DeletedIds []string `json:"deleted_ids,omitempty"`
+
+	Template     *Template `json:"template,omitempty"`
+	TemplateName string    `json:"template_name,omitempty"`
+}
+
+// storedBoard is the snapshot form of a board.
+type storedBoard struct {
+	Id      string       `json:"id"`
+	Version uint64       `json:"version"`
+	State   BoardState   `json:"state"`
+	Items   []storedItem `json:"items"`
+}
+
+// storedSnapshot is the snapshot of the boards and templates.
+// Older snapshots are a list of boards only.
+type storedSnapshot struct {
+	Boards    []storedBoard `json:"boards"`
+	Templates []*Template   `json:"templates"`
+}
+
+// logStore appends every change to a log file as a length-prefixed,
+// checksummed JSON record and syncs it before returning.
+// Compaction writes the boards to a snapshot file and starts a new log.
+// Older logs are kept next to it as the audit trail.
+type logStore struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+
+	// templates are the custom templates read by Load.
+	templates map[string]*Template
+}
+
+// NewEventLogRepo opens or creates the event log at path and rebuilds the
+// boards from the last snapshot and the log. The log is compacted into a
+// new snapshot at the given interval, if it is not zero.
+func NewEventLogRepo(path string, compactEvery time.Duration) (Repo, error) {
+	s := &logStore{path: path}
+
+	r, err := newStoreRepo(s)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	if compactEvery > 0 {
+		r.compactEvery(compactEvery)
+	}
+	return r, nil
+}
+
+// snapshotPath is where the snapshot of the boards is kept.
+func (s *logStore) snapshotPath() string {
+	return s.path + ".snapshot"
+}
+
+// Load reads the snapshot, replays the log on top of it and opens the log
+// for appending. A torn record at the end of the log is cut off, any other
+// damage fails the load and leaves the log as it is.
+func (s *logStore) Load() ([]*Board, error) {
+	boards, templates, err := s.readSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replay the events up to the last complete record. A record that ends
+	// early was torn by a crash while appending, anything else is corrupt.
+	var offset int64
+	reader := bufio.NewReader(f)
+	for {
+		e, n, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = checkTornRecord(f, offset)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("event log corrupt at offset %d: %w", offset, err)
+		}
+		offset += n
+		applyEvent(boards, templates, e)
+	}
+	s.file = f
+	s.templates = templates
+
+	if err := f.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	list := make([]*Board, 0, len(boards))
+	for _, b := range boards {
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+// readSnapshot reads the boards and templates in the snapshot file,
+// if there is one.
+func (s *logStore) readSnapshot() (map[string]*Board, map[string]*Template, error) {
+	boards := make(map[string]*Board)
+	templates := make(map[string]*Template)
+
+	data, err := os.ReadFile(s.snapshotPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return boards, templates, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stored := storedSnapshot{}
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &stored.Boards)
+	} else {
+		err = json.Unmarshal(data, &stored)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, t := range stored.Templates {
+		templates[t.Name] = t
+	}
+	for _, sb := range stored.Boards {
+		b := newBoard(sb.Id)
+		b.Version = sb.Version
+		b.BoardState = sb.State
+		for _, si := range sb.Items {
+			si.Item.Version = si.Version
+			b.Items[si.Item.Id] = si.Item
+		}
+		boards[b.Id] = b
+	}
+	return boards, templates, nil
+}
+
+// applyEvent replays an event on the boards and templates. Events which
+// are already in the snapshot are skipped.
+func applyEvent(boards map[string]*Board, templates map[string]*Template, e *logEvent) {
+	b := boards[e.BoardId]
+
+	switch e.Type {
+	case eventSaveTemplate:
+		templates[e.Template.Name] = e.Template
+		return
+	case eventDeleteTemplate:
+		delete(templates, e.TemplateName)
+		return
+	case eventCreateBoard:
+		if b == nil {
+			b = newBoard(e.BoardId)
+			if e.State != nil {
+				b.BoardState = *e.State
+			}
+			boards[e.BoardId] = b
+		}
+		return
+	case eventDeleteBoard:
+		delete(boards, e.BoardId)
+		return
+	}
+	// A commit may record several events with its version, the events
+	// are safe to apply again.
+	if b == nil || e.Version < b.Version {
+		return
+	}
+
+	b.Version = e.Version
+	if e.State != nil {
+		b.BoardState = *e.State
+	}
+	if e.Item != nil {
+		e.Item.Version = e.Version
+		b.Items[e.Item.Id] = e.Item
+	}
+	if e.Type == eventDeleteItem {
+		delete(b.Items, e.ItemId)
+	}
+	for _, it := range e.Items {
+		b.Items[it.Id] = it
+	}
+	for _, id := range e.DeletedIds {
+		delete(b.Items, id)
+	}
+}
+
+// CreateBoard records a new board.
+func (s *logStore) CreateBoard(b *Board) error {
+	return s.append(&logEvent{Type: eventCreateBoard, BoardId: b.Id, Version: b.Version, State: b.BoardState.stored()})
+}
+
+// UpdateBoard records a new board version and state.
+func (s *logStore) UpdateBoard(boardId string, version uint64, state *BoardState) error {
+	return s.append(&logEvent{Type: eventUpdateBoard, BoardId: boardId, Version: version, State: state.stored()})
+}
+
+// DeleteBoard records a board deletion.
+func (s *logStore) DeleteBoard(boardId string) error {
+	return s.append(&logEvent{Type: eventDeleteBoard, BoardId: boardId})
+}
+
+// CreateItem records a new item.
+func (s *logStore) CreateItem(boardId string, it *Item) error {
+	return s.append(&logEvent{Type: eventCreateItem, BoardId: boardId, Version: it.Version, Item: it})
+}
+
+// UpdateItem records an item update.
+func (s *logStore) UpdateItem(boardId string, it *Item) error {
+	return s.append(&logEvent{Type: eventUpdateItem, BoardId: boardId, Version: it.Version, Item: it})
+}
+
+// DeleteItem records an item deletion.
+func (s *logStore) DeleteItem(boardId string, itemId string, version uint64) error {
+	return s.append(&logEvent{Type: eventDeleteItem, BoardId: boardId, Version: version, ItemId: itemId})
+}
+
+// UpdateBoardItems records the board state with the changed and deleted
+// items as one event.
+func (s *logStore) UpdateBoardItems(boardId string, version uint64, state *BoardState, items []*Item, deletedIds []string) error {
+	return s.append(&logEvent{Type: eventUpdateBoardItems, BoardId: boardId, Version: version, State: state.stored(), Items: items, DeletedIds: deletedIds})
+}
+
+// LoadTemplates returns the custom templates read by Load.
+func (s *logStore) LoadTemplates() ([]*Template, error) {
+	templates := make([]*Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// SaveTemplate records a custom template.
+func (s *logStore) SaveTemplate(t *Template) error {
+	return s.append(&logEvent{Type: eventSaveTemplate, Template: t})
+}
+
+// DeleteTemplate records a custom template deletion.
+func (s *logStore) DeleteTemplate(name string) error {
+	return s.append(&logEvent{Type: eventDeleteTemplate, TemplateName: name})
+}
+
+// append writes an event to the log and syncs it to disk.
+func (s *logStore) append(e *logEvent) error {
+	e.Time = time.Now().UTC()
+	record, err := encodeRecord(e)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(record); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Snapshot writes the boards and templates to the snapshot file and moves
+// the current log aside, so that the next start only replays the changes
+// after it. The boards and templates must be locked so that no change is
+// appended meanwhile.
+func (s *logStore) Snapshot(boards []*Board, templates []*Template) error {
+	stored := storedSnapshot{
+		Boards:    make([]storedBoard, 0, len(boards)),
+		Templates: templates,
+	}
+	for _, b := range boards {
+		sb := storedBoard{Id: b.Id, Version: b.Version, State: *b.BoardState.stored(), Items: []storedItem{}}
+		for _, it := range b.Items {
+			sb.Items = append(sb.Items, storedItem{Version: it.Version, Item: it})
+		}
+		stored.Boards = append(stored.Boards, sb)
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := writeFileSync(s.snapshotPath(), data); err != nil {
+		return err
+	}
+
+	// Keep the compacted log for the audit trail and start a new one.
+	archived := fmt.Sprintf("%s.%d", s.path, time.Now().UnixNano())
+	if err := os.Rename(s.path, archived); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		// Carry on with the current log.
+		os.Rename(archived, s.path)
+		return err
+	}
+	s.file.Close()
+	s.file = f
+
+	return syncDir(filepath.Dir(s.path))
+}
+
+// Close closes the log file.
+func (s *logStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// encodeRecord frames an event as its length, its checksum and its JSON.
+func encodeRecord(e *logEvent) ([]byte, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) > maxRecordSize {
+		return nil, errors.New("record_too_large")
+	}
+
+	record := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	return append(record, payload...), nil
+}
+
+// readRecord reads the next event and returns the size of its record.
+func readRecord(r io.Reader) (*logEvent, int64, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, 0, errors.New("corrupt_record")
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("corrupt_record")
+	}
+
+	e := &logEvent{}
+	if err := json.Unmarshal(payload, e); err != nil {
+		return nil, 0, err
+	}
+	return e, int64(len(header) + len(payload)), nil
+}
+
+// checkTornRecord checks that the record cut short at the offset is the
+// last one of the log, as a crash while appending leaves it. A corrupt
+// length cuts a record short too, but then the payload it was written with
+// still follows its header, which the checksum finds.
+func checkTornRecord(f *os.File, offset int64) error {
+	tail, err := io.ReadAll(io.NewSectionReader(f, offset, 8+maxRecordSize))
+	if err != nil {
+		return err
+	}
+	if len(tail) < 8 {
+		return nil
+	}
+
+	sum := binary.BigEndian.Uint32(tail[4:8])
+	crc := uint32(0)
+	for i := 8; i < len(tail); i++ {
+		crc = crc32.Update(crc, crc32.IEEETable, tail[i:i+1])
+		if crc == sum {
+			return errors.New("corrupt_record")
+		}
+	}
+	return nil
+}
+
+// writeFileSync replaces a file with the data atomically.
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// syncDir syncs a directory so that renames in it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
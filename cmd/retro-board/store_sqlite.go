@@ -0,0 +1,320 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+
+	// Pure Go driver, no cgo needed.
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order, the database user_version
+// holds the number of applied migrations.
+var sqliteMigrations = []string{
+	`CREATE TABLE boards (
+		id      TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	);
+	CREATE TABLE items (
+		id       TEXT PRIMARY KEY,
+		board_id TEXT NOT NULL REFERENCES boards(id),
+		version  INTEGER NOT NULL,
+		data     TEXT NOT NULL
+	);
+	CREATE INDEX items_board_id ON items(board_id);`,
+	`ALTER TABLE boards ADD COLUMN state TEXT NOT NULL DEFAULT '{}';`,
+	`CREATE TABLE templates (
+		name TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	);`,
+}
+
+// sqliteStore stores boards in a SQLite database.
+// Items and board states are kept as JSON next to their version.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteRepo opens or creates the SQLite database at path
+// and loads its boards.
+func NewSQLiteRepo(path string) (Repo, error) {
+	s, err := openSQLiteStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newStoreRepo(s)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// openSQLiteStore opens the database and brings its schema up to date.
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes the writes.
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies the pending schema migrations.
+func (s *sqliteStore) migrate() error {
+	var applied int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&applied); err != nil {
+		return err
+	}
+
+	for i := applied; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		// PRAGMA doesn't take parameters.
+		if _, err := tx.Exec("PRAGMA user_version = " + strconv.Itoa(i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads all the boards with their items.
+func (s *sqliteStore) Load() ([]*Board, error) {
+	rows, err := s.db.Query("SELECT id, version, state FROM boards")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	boards := make(map[string]*Board)
+	var list []*Board
+	for rows.Next() {
+		var id, state string
+		var version uint64
+		if err := rows.Scan(&id, &version, &state); err != nil {
+			return nil, err
+		}
+		b := newBoard(id)
+		b.Version = version
+		if err := json.Unmarshal([]byte(state), &b.BoardState); err != nil {
+			return nil, err
+		}
+		boards[id] = b
+		list = append(list, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	itemRows, err := s.db.Query("SELECT board_id, version, data FROM items")
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var boardId, data string
+		var version uint64
+		if err := itemRows.Scan(&boardId, &version, &data); err != nil {
+			return nil, err
+		}
+		it := &Item{}
+		if err := json.Unmarshal([]byte(data), it); err != nil {
+			return nil, err
+		}
+		it.Version = version
+		if b, ok := boards[boardId]; ok {
+			b.Items[it.Id] = it
+		}
+	}
+	return list, itemRows.Err()
+}
+
+// LoadTemplates reads the custom templates.
+func (s *sqliteStore) LoadTemplates() ([]*Template, error) {
+	rows, err := s.db.Query("SELECT data FROM templates")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*Template
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		t := &Template{}
+		if err := json.Unmarshal([]byte(data), t); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// SaveTemplate inserts or replaces a custom template.
+func (s *sqliteStore) SaveTemplate(t *Template) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("INSERT OR REPLACE INTO templates (name, data) VALUES (?, ?)", t.Name, string(data))
+	return err
+}
+
+// DeleteTemplate deletes a custom template.
+func (s *sqliteStore) DeleteTemplate(name string) error {
+	_, err := s.db.Exec("DELETE FROM templates WHERE name = ?", name)
+	return err
+}
+
+// CreateBoard inserts a board.
+func (s *sqliteStore) CreateBoard(b *Board) error {
+	state, err := json.Marshal(b.BoardState.stored())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("INSERT INTO boards (id, version, state) VALUES (?, ?, ?)", b.Id, b.Version, string(state))
+	return err
+}
+
+// UpdateBoard updates the board version and state.
+func (s *sqliteStore) UpdateBoard(boardId string, version uint64, state *BoardState) error {
+	data, err := json.Marshal(state.stored())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE boards SET version = ?, state = ? WHERE id = ?", version, string(data), boardId)
+	return err
+}
+
+// DeleteBoard deletes a board with its items.
+func (s *sqliteStore) DeleteBoard(boardId string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM items WHERE board_id = ?", boardId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM boards WHERE id = ?", boardId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateItem inserts an item and updates the board version.
+func (s *sqliteStore) CreateItem(boardId string, it *Item) error {
+	return s.saveItem("INSERT INTO items (board_id, version, data, id) VALUES (?, ?, ?, ?)", boardId, it)
+}
+
+// UpdateItem updates an item and the board version.
+func (s *sqliteStore) UpdateItem(boardId string, it *Item) error {
+	return s.saveItem("UPDATE items SET board_id = ?, version = ?, data = ? WHERE id = ?", boardId, it)
+}
+
+// saveItem writes an item with the given statement and updates the board
+// version in the same transaction.
+func (s *sqliteStore) saveItem(query string, boardId string, it *Item) error {
+	data, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, boardId, it.Version, string(data), it.Id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("UPDATE boards SET version = ? WHERE id = ?", it.Version, boardId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteItem deletes an item and updates the board version.
+func (s *sqliteStore) DeleteItem(boardId string, itemId string, version uint64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM items WHERE id = ? AND board_id = ?", itemId, boardId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("UPDATE boards SET version = ? WHERE id = ?", version, boardId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateBoardItems updates the changed items, deletes the deleted ones and
+// updates the board version and state in one transaction.
+func (s *sqliteStore) UpdateBoardItems(boardId string, version uint64, state *BoardState, items []*Item, deletedIds []string) error {
+	data, err := json.Marshal(state.stored())
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		itemData, err := json.Marshal(it)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec("UPDATE items SET version = ?, data = ? WHERE id = ? AND board_id = ?", it.Version, string(itemData), it.Id, boardId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, id := range deletedIds {
+		if _, err := tx.Exec("DELETE FROM items WHERE id = ? AND board_id = ?", id, boardId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE boards SET version = ?, state = ? WHERE id = ?", version, string(data), boardId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the database.
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteRepo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retro-board.db")
+
+	testRepoPersistence(t, func() (Repo, error) {
+		return NewSQLiteRepo(path)
+	})
+}
+
+func TestBoltRepo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retro-board.bolt")
+
+	testRepoPersistence(t, func() (Repo, error) {
+		return NewBoltRepo(path)
+	})
+}
+
+func TestEventLogRepo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retro-board.log")
+
+	testRepoPersistence(t, func() (Repo, error) {
+		return NewEventLogRepo(path, 0)
+	})
+}
+
+func TestEventLogRepoCompaction(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "retro-board.log")
+
+	r, err := NewEventLogRepo(path, 0)
+	require.NoError(t, err)
+
+	b, _ := r.CreateBoard()
+	first, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+	r.SaveTemplate(&Template{Name: "team"})
+	assert.NoError(t, r.(*memoryRepo).Compact())
+
+	// Changes after the snapshot go to a new log.
+	r.UpdateItem(b.Id, first.Id, &Item{Text: "bar"})
+	second, _ := r.CreateItem(b.Id, &Item{Text: "baz"})
+	assert.NoError(t, r.Close())
+
+	// The compacted log is kept for the audit trail.
+	archived, _ := filepath.Glob(path + ".[0-9]*")
+	assert.Len(t, archived, 1)
+
+	r, err = NewEventLogRepo(path, 0)
+	require.NoError(t, err)
+	defer r.Close()
+
+	loaded, err := r.GetBoard(b.Id)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, 3, loaded.Version)
+	assert.Equal(t, "bar", loaded.Items[first.Id].Text)
+	assert.Equal(t, "baz", loaded.Items[second.Id].Text)
+
+	templates, _ := r.GetTemplates()
+	assert.Equal(t, "team", templates[len(templates)-1].Name)
+}
+
+func TestEventLogRepoTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retro-board.log")
+
+	r, err := NewEventLogRepo(path, 0)
+	require.NoError(t, err)
+	b, _ := r.CreateBoard()
+	r.CreateItem(b.Id, &Item{Text: "foo"})
+	assert.NoError(t, r.Close())
+
+	// Simulate a crash in the middle of a write.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	f.Write([]byte{0, 0, 1, 0, 42})
+	f.Close()
+
+	r, err = NewEventLogRepo(path, 0)
+	require.NoError(t, err)
+
+	// The torn record is dropped and the log stays usable.
+	loaded, err := r.GetBoard(b.Id)
+	assert.NoError(t, err)
+	assert.Len(t, loaded.Items, 1)
+	r.CreateItem(b.Id, &Item{Text: "bar"})
+	assert.NoError(t, r.Close())
+
+	r, err = NewEventLogRepo(path, 0)
+	require.NoError(t, err)
+	defer r.Close()
+
+	loaded, err = r.GetBoard(b.Id)
+	assert.NoError(t, err)
+	assert.Len(t, loaded.Items, 2)
+}
+
+func TestEventLogRepoCorruptRecord(t *testing.T) {
+	// Each case damages the second record of a log of four.
+	corruptions := []struct {
+		name    string
+		corrupt func(record []byte, rest int)
+	}{
+		{"payload", func(record []byte, rest int) { record[10] ^= 0xff }},
+		{"checksum", func(record []byte, rest int) { record[4] ^= 0xff }},
+		{"length over the limit", func(record []byte, rest int) {
+			binary.BigEndian.PutUint32(record[0:4], 0xffffffff)
+		}},
+		{"length past the end", func(record []byte, rest int) {
+			binary.BigEndian.PutUint32(record[0:4], uint32(rest))
+		}},
+	}
+
+	for _, c := range corruptions {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "retro-board.log")
+
+			r, err := NewEventLogRepo(path, 0)
+			require.NoError(t, err)
+			b, _ := r.CreateBoard()
+			r.CreateItem(b.Id, &Item{Text: "foo"})
+			r.CreateItem(b.Id, &Item{Text: "bar"})
+			r.CreateItem(b.Id, &Item{Text: "baz"})
+			assert.NoError(t, r.Close())
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			second := 8 + int(binary.BigEndian.Uint32(data[0:4]))
+			c.corrupt(data[second:], len(data)-second)
+			require.NoError(t, os.WriteFile(path, data, 0600))
+
+			// The load fails and the records after the corrupt one are kept.
+			_, err = NewEventLogRepo(path, 0)
+			assert.Error(t, err)
+			after, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, data, after)
+		})
+	}
+}
+
+// failingStore fails the writes of several items at once.
+type failingStore struct {
+	nopStore
+}
+
+func (failingStore) UpdateBoardItems(boardId string, v uint64, st *BoardState, items []*Item, ids []string) error {
+	return errors.New("disk_full")
+}
+
+func TestRepoStoreFailure(t *testing.T) {
+	r, err := newStoreRepo(failingStore{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	b, _ := r.CreateBoard()
+	column, _ := r.CreateColumn(b.Id, &Column{Title: "Went well"})
+	first, _ := r.CreateItem(b.Id, &Item{Text: "foo", ColumnId: column.Id})
+	r.CreateItem(b.Id, &Item{Text: "bar", ColumnId: column.Id})
+	version := b.Version
+
+	// A failed write leaves the column and its items as they were.
+	_, err = r.DeleteColumn(b.Id, column.Id)
+	assert.Error(t, err)
+	assert.Equal(t, version, b.Version)
+	assert.Len(t, b.Columns, 1)
+	assert.Equal(t, column.Id, b.Items[first.Id].ColumnId)
+
+	// So does one of an item deletion leaving its group.
+	group, _ := r.CreateGroup(b.Id, &Group{Items: []string{first.Id}})
+	version = b.Version
+	_, err = r.DeleteItem(b.Id, first.Id)
+	assert.Error(t, err)
+	assert.Equal(t, version, b.Version)
+	assert.Contains(t, b.Items, first.Id)
+	assert.Equal(t, []string{first.Id}, b.Groups[group.Id].Items)
+}
+
+// testRepoPersistence checks that the boards of a store-backed repo
+// survive reopening it. Each case changes the repo and returns the check
+// of the reopened one.
+func testRepoPersistence(t *testing.T, open func() (Repo, error)) {
+	cases := []struct {
+		name   string
+		change func(t *testing.T, r Repo) func(t *testing.T, r Repo)
+	}{
+		{"items", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, err := r.CreateBoard()
+			require.NoError(t, err)
+			first, err := r.CreateItem(b.Id, &Item{Text: "foo", Color: "red", Left: 1})
+			require.NoError(t, err)
+			second, err := r.CreateItem(b.Id, &Item{Text: "bar"})
+			require.NoError(t, err)
+			_, err = r.UpdateItem(b.Id, first.Id, &Item{Text: "baz", Color: "green", Top: 2})
+			require.NoError(t, err)
+			deleted, err := r.CreateItem(b.Id, &Item{Text: "qux"})
+			require.NoError(t, err)
+			_, err = r.DeleteItem(b.Id, deleted.Id)
+			require.NoError(t, err)
+
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				assert.EqualValues(t, 5, loaded.Version)
+				assert.Len(t, loaded.Items, 2)
+
+				item, err := r.GetItem(loaded, first.Id)
+				assert.NoError(t, err)
+				assert.Equal(t, &Item{Id: first.Id, Version: 3, Text: "baz", Color: "green", Top: 2}, item)
+
+				item, err = r.GetItem(loaded, second.Id)
+				assert.NoError(t, err)
+				assert.EqualValues(t, 2, item.Version)
+			}
+		}},
+		{"archived board", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			column, err := r.CreateColumn(b.Id, &Column{Title: "Went well", Color: "green"})
+			require.NoError(t, err)
+			group, err := r.CreateGroup(b.Id, &Group{Title: "Tooling", Width: 100})
+			require.NoError(t, err)
+			_, err = r.Join(b.Id, &Participant{Id: "alice", Name: "Alice"})
+			require.NoError(t, err)
+			_, err = r.ArchiveBoard(b.Id)
+			require.NoError(t, err)
+
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				assert.True(t, loaded.Archived)
+				assert.Equal(t, []Column{*column}, loaded.Columns)
+				assert.Equal(t, map[string]*Group{group.Id: group}, loaded.Groups)
+				// No one is online after a restart.
+				assert.Equal(t, map[string]*Participant{"alice": {Id: "alice", Name: "Alice"}}, loaded.Participants)
+				assert.EqualValues(t, 4, loaded.Version)
+			}
+		}},
+		{"templates", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			saved, err := r.SaveTemplate(&Template{Name: "team", Columns: []Column{{Title: "Went well"}}})
+			require.NoError(t, err)
+			r.SaveTemplate(&Template{Name: "gone"})
+			_, err = r.DeleteTemplate("gone")
+			require.NoError(t, err)
+
+			return func(t *testing.T, r Repo) {
+				templates, _ := r.GetTemplates()
+				assert.Equal(t, saved, templates[len(templates)-1])
+				assert.Len(t, templates, len(builtinTemplates)+1)
+			}
+		}},
+		{"column deletion", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			column, _ := r.CreateColumn(b.Id, &Column{Title: "To improve"})
+			items := make([]*Item, 2)
+			for i := range items {
+				var err error
+				items[i], err = r.CreateItem(b.Id, &Item{Text: "foo", ColumnId: column.Id})
+				require.NoError(t, err)
+			}
+			_, err := r.DeleteColumn(b.Id, column.Id)
+			require.NoError(t, err)
+
+			// The items of a deleted column are left without one.
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				assert.Empty(t, loaded.Columns)
+				assert.EqualValues(t, 4, loaded.Version)
+				for _, it := range items {
+					item, err := r.GetItem(loaded, it.Id)
+					assert.NoError(t, err)
+					assert.Empty(t, item.ColumnId)
+					assert.EqualValues(t, 4, item.Version)
+				}
+			}
+		}},
+		{"item deletion", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			kept, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+			dropped, _ := r.CreateItem(b.Id, &Item{Text: "bar"})
+			group, err := r.CreateGroup(b.Id, &Group{Items: []string{kept.Id, dropped.Id}})
+			require.NoError(t, err)
+			action, err := r.CreateAction(b.Id, &Action{Title: "Fix CI", ItemId: dropped.Id})
+			require.NoError(t, err)
+			_, err = r.DeleteItem(b.Id, dropped.Id)
+			require.NoError(t, err)
+
+			// Deleted items leave their group and their action items.
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				assert.Len(t, loaded.Items, 1)
+				if assert.Contains(t, loaded.Groups, group.Id) {
+					assert.Equal(t, []string{kept.Id}, loaded.Groups[group.Id].Items)
+				}
+				if assert.Contains(t, loaded.Actions, action.Id) {
+					assert.Empty(t, loaded.Actions[action.Id].ItemId)
+				}
+				assert.EqualValues(t, 5, loaded.Version)
+			}
+		}},
+		{"hidden votes", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			ballot, _ := r.CreateItem(b.Id, &Item{Text: "foo"})
+			r.SetVisibility(b.Id, "", Visibility{HideVotes: true})
+			_, err := r.AddVote(b.Id, ballot.Id, "alice")
+			require.NoError(t, err)
+
+			// Hidden votes change no version.
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				assert.EqualValues(t, 2, loaded.Version)
+				item, err := r.GetItem(loaded, ballot.Id)
+				assert.NoError(t, err)
+				assert.Equal(t, ballot.Version, item.Version)
+				assert.Equal(t, map[string]int{"alice": 1}, item.Votes)
+			}
+		}},
+		{"presence", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			_, err := r.Join(b.Id, &Participant{Id: "alice", Name: "Alice"})
+			require.NoError(t, err)
+			require.NoError(t, r.Heartbeat(b.Id, "bob"))
+			_, err = r.Leave(b.Id, "alice")
+			require.NoError(t, err)
+
+			// Presence changes are not stored, the join is stored offline.
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				assert.EqualValues(t, 1, loaded.Version)
+				assert.Equal(t, map[string]*Participant{"alice": {Id: "alice", Name: "Alice"}}, loaded.Participants)
+
+				// A version seen before the restart is ahead of the board,
+				// the whole board is returned.
+				updates, err := r.GetBoardUpdates(context.Background(), loaded, 3)
+				assert.NoError(t, err)
+				assert.True(t, updates.Full)
+			}
+		}},
+		{"deleted board", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			r.CreateItem(b.Id, &Item{Text: "foo"})
+			_, err := r.DeleteBoard(b.Id)
+			require.NoError(t, err)
+
+			return func(t *testing.T, r Repo) {
+				_, err := r.GetBoard(b.Id)
+				assert.Error(t, err)
+			}
+		}},
+		{"updates after restart", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			r.CreateItem(b.Id, &Item{Text: "foo"})
+			r.CreateItem(b.Id, &Item{Text: "bar"})
+
+			// Changes before the restart are not known, the whole board is returned.
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				updates, err := r.GetBoardUpdates(context.Background(), loaded, 1)
+				assert.NoError(t, err)
+				assert.True(t, updates.Full)
+				assert.Len(t, updates.Items, 2)
+			}
+		}},
+		{"versions continue", func(t *testing.T, r Repo) func(t *testing.T, r Repo) {
+			b, _ := r.CreateBoard()
+			r.CreateItem(b.Id, &Item{Text: "foo"})
+			r.CreateItem(b.Id, &Item{Text: "bar"})
+
+			// Versions continue from the stored ones.
+			return func(t *testing.T, r Repo) {
+				loaded, err := r.GetBoard(b.Id)
+				require.NoError(t, err)
+				created, err := r.CreateItem(b.Id, &Item{Text: "baz"})
+				assert.NoError(t, err)
+				assert.EqualValues(t, 3, created.Version)
+
+				updates, err := r.GetBoardUpdates(context.Background(), loaded, 2)
+				assert.NoError(t, err)
+				assert.False(t, updates.Full)
+				assert.Len(t, updates.Items, 1)
+				assert.Contains(t, updates.Items, created.Id)
+			}
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := open()
+			require.NoError(t, err)
+			check := c.change(t, r)
+			require.NoError(t, r.Close())
+
+			r, err = open()
+			require.NoError(t, err)
+			defer r.Close()
+			check(t, r)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+// builtinTemplates are the board templates for common retro formats.
+var builtinTemplates = []*Template{
+	{
+		Name:    "start-stop-continue",
+		Title:   "Start, Stop, Continue",
+		BuiltIn: true,
+		Columns: []Column{
+			{Title: "Start", Color: "green", Prompt: "What should we start doing?"},
+			{Title: "Stop", Color: "red", Prompt: "What should we stop doing?"},
+			{Title: "Continue", Color: "blue", Prompt: "What should we keep doing?"},
+		},
+	},
+	{
+		Name:    "mad-sad-glad",
+		Title:   "Mad, Sad, Glad",
+		BuiltIn: true,
+		Columns: []Column{
+			{Title: "Mad", Color: "red", Prompt: "What drove you crazy?"},
+			{Title: "Sad", Color: "blue", Prompt: "What disappointed you?"},
+			{Title: "Glad", Color: "green", Prompt: "What made you happy?"},
+		},
+	},
+	{
+		Name:    "4ls",
+		Title:   "4Ls",
+		BuiltIn: true,
+		Columns: []Column{
+			{Title: "Liked", Color: "green", Prompt: "What did you like?"},
+			{Title: "Learned", Color: "blue", Prompt: "What did you learn?"},
+			{Title: "Lacked", Color: "orange", Prompt: "What was missing?"},
+			{Title: "Longed for", Color: "purple", Prompt: "What do you wish we had?"},
+		},
+	},
+	{
+		Name:    "sailboat",
+		Title:   "Sailboat",
+		BuiltIn: true,
+		Columns: []Column{
+			{Title: "Wind", Color: "green", Prompt: "What pushes us forward?"},
+			{Title: "Anchors", Color: "red", Prompt: "What holds us back?"},
+			{Title: "Rocks", Color: "orange", Prompt: "What risks lie ahead?"},
+			{Title: "Island", Color: "blue", Prompt: "Where do we want to get to?"},
+		},
+	},
+	{
+		Name:    "starfish",
+		Title:   "Starfish",
+		BuiltIn: true,
+		Columns: []Column{
+			{Title: "Keep doing", Color: "green", Prompt: "What works well?"},
+			{Title: "More of", Color: "blue", Prompt: "What should we do more?"},
+			{Title: "Less of", Color: "orange", Prompt: "What should we do less?"},
+			{Title: "Stop doing", Color: "red", Prompt: "What doesn't help us?"},
+			{Title: "Start doing", Color: "purple", Prompt: "What should we try?"},
+		},
+	},
+}
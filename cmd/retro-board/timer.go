@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Timer actions.
+const (
+	timerStart  = "start"
+	timerPause  = "pause"
+	timerResume = "resume"
+	timerReset  = "reset"
+	timerExtend = "extend"
+)
+
+// ControlTimer runs an action on the timer of a board. Only the facilitator
+// can, if the board has one. Start runs the timer for the duration, pause
+// and resume stop and run it, reset stops it with the whole duration left
+// and extend adds the duration to it.
+func (r *memoryRepo) ControlTimer(boardId string, participantId string, req *TimerRequest) (*Board, error) {
+	if req == nil || req.Duration < 0 {
+		return nil, errors.New("input_error")
+	}
+
+	b, err := r.lockWritableBoard(boardId)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Mutex.Unlock()
+
+	if err := checkFacilitator(b, participantId); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var t Timer
+	if b.Timer != nil {
+		t = *b.Timer
+	} else if req.Action != timerStart {
+		return nil, errors.New("timer_not_found")
+	}
+
+	switch req.Action {
+	case timerStart:
+		if req.Duration == 0 {
+			return nil, errors.New("input_error")
+		}
+		t = Timer{Duration: req.Duration, AdvancePhase: req.AdvancePhase}
+		t.run(now, req.Duration)
+	case timerPause:
+		if !t.Running {
+			return nil, errors.New("timer_not_running")
+		}
+		t.pause(now)
+	case timerResume:
+		if t.Running || t.Remaining == 0 {
+			return nil, errors.New("timer_not_paused")
+		}
+		t.run(now, t.Remaining)
+	case timerReset:
+		t = Timer{Duration: t.Duration, Remaining: t.Duration, AdvancePhase: t.AdvancePhase}
+	case timerExtend:
+		if req.Duration == 0 {
+			return nil, errors.New("input_error")
+		}
+		t.Duration += req.Duration
+		switch {
+		case t.Running:
+			t.run(now, t.EndsAt.Sub(now).Seconds()+req.Duration)
+		case t.Expired:
+			// An expired timer runs again.
+			t.Expired = false
+			t.run(now, req.Duration)
+		default:
+			t.Remaining += req.Duration
+		}
+	default:
+		return nil, errors.New("invalid_timer_action")
+	}
+
+	state := b.clone()
+	state.Timer = &t
+	if err := r.updateState(b, state); err != nil {
+		return nil, err
+	}
+	r.scheduleTimer(b)
+
+	return b, nil
+}
+
+// run makes the timer run for the given seconds from now.
+func (t *Timer) run(now time.Time, seconds float64) {
+	endsAt := now.Add(time.Duration(seconds * float64(time.Second)))
+	t.EndsAt = &endsAt
+	t.Remaining = 0
+	t.Running = true
+	t.Expired = false
+}
+
+// pause stops the timer with the time left until its end.
+func (t *Timer) pause(now time.Time) {
+	t.Remaining = t.EndsAt.Sub(now).Seconds()
+	if t.Remaining < 0 {
+		t.Remaining = 0
+	}
+	t.Running = false
+	t.EndsAt = nil
+}
+
+// scheduleTimer makes a running timer of a board expire in time.
+// Must be called while holding the board lock.
+func (r *memoryRepo) scheduleTimer(b *Board) {
+	if b.expiry != nil {
+		b.expiry.Stop()
+		b.expiry = nil
+	}
+	if b.Timer == nil || !b.Timer.Running {
+		return
+	}
+
+	endsAt := *b.Timer.EndsAt
+	b.expiry = time.AfterFunc(time.Until(endsAt), func() {
+		r.expireTimer(b, endsAt)
+	})
+}
+
+// expireTimer stops the timer of a board if it is still running to the
+// given end time and notifies the listeners. The board moves to the next
+// phase if the timer says so.
+func (r *memoryRepo) expireTimer(b *Board, endsAt time.Time) {
+	// The registry lock keeps the repo from closing meanwhile.
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.closed {
+		return
+	}
+
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+
+	t := b.Timer
+	if b.deleted || b.Archived || t == nil || !t.Running || !t.EndsAt.Equal(endsAt) {
+		return
+	}
+
+	state := b.clone()
+	state.Timer.Running = false
+	state.Timer.Expired = true
+	if t.AdvancePhase && b.Phase != "" {
+		if next, err := nextPhase(b.Phase); err == nil {
+			state.Phase = next
+		}
+	}
+
+	if err := r.updateState(b, state); err != nil {
+		log.Printf("timer expiry failed: %s", err)
+	}
+	b.expiry = nil
+}
@@ -1,10 +1,16 @@
 package main
 
-import "sync"
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
 
 // ErrorResponse used for service responses.
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Item is the current item on a version conflict.
+	Item *Item `json:"item,omitempty"`
 }
 
 // HealthCheck
@@ -15,7 +21,255 @@ type HealthCheck struct {
 // BoardSync is the board synchronization data.
 type BoardSync struct {
 	Mutex sync.Mutex
-	Cond  *sync.Cond
+	// Changed is closed and replaced on every board update.
+	Changed chan struct{}
+}
+
+// Change is an entry of the board change log.
+type Change struct {
+	Version uint64
+	ItemId  string
+	// GroupId is set instead of the item id for group changes.
+	GroupId string
+	// ActionId is set instead of the item id for action changes.
+	ActionId string
+}
+
+// BoardState is the board data apart from its items.
+type BoardState struct {
+	// Archived boards are read-only.
+	Archived bool `json:"archived"`
+	// Columns are the lanes of the board in order.
+	Columns []Column `json:"columns"`
+	// VoteBudget is how many votes a participant has, zero for no limit.
+	VoteBudget int `json:"vote_budget"`
+	// VoteBudgets are the budgets of the participants with their own.
+	VoteBudgets map[string]int `json:"vote_budgets,omitempty"`
+	// Facilitator is the participant running the board, if any.
+	Facilitator string `json:"facilitator"`
+	// Phase is the phase of the retro, empty if the board isn't run
+	// in phases.
+	Phase string `json:"phase"`
+	// Timer is the countdown of the board, if it has one.
+	Timer *Timer `json:"timer,omitempty"`
+	// Groups are the clusters of items by id.
+	Groups map[string]*Group `json:"groups,omitempty"`
+	// Actions are the action items of the board by id.
+	Actions map[string]*Action `json:"actions,omitempty"`
+	// Participants are the participants of the board by id.
+	Participants map[string]*Participant `json:"participants,omitempty"`
+	Visibility
+}
+
+// Timer is a countdown shared by the participants of a board.
+// A running timer ends at its end time, a stopped one has the remaining
+// time left. Times are in seconds.
+type Timer struct {
+	Duration  float64    `json:"duration"`
+	Remaining float64    `json:"remaining"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	Running   bool       `json:"running"`
+	Expired   bool       `json:"expired"`
+	// AdvancePhase moves the board to the next phase when the timer expires.
+	AdvancePhase bool `json:"advance_phase"`
+}
+
+// TimerRequest is an action on a board timer, with the duration to start
+// or extend it by in seconds.
+type TimerRequest struct {
+	Action       string  `json:"action"`
+	Duration     float64 `json:"duration"`
+	AdvancePhase bool    `json:"advance_phase"`
+}
+
+// Visibility are the rules of what the participants see of each other.
+type Visibility struct {
+	// HideCards hides the text of the items from everyone but the author.
+	HideCards bool `json:"hide_cards"`
+	// HideVotes hides the votes of the others.
+	HideVotes bool `json:"hide_votes"`
+}
+
+// PhaseRequest moves a board to a phase, or the next one if it is empty.
+type PhaseRequest struct {
+	Phase string `json:"phase"`
+}
+
+// Facilitator hands over the facilitator role of a board.
+type Facilitator struct {
+	ParticipantId string `json:"participant_id"`
+}
+
+// clone copies the board state.
+func (s *BoardState) clone() BoardState {
+	c := *s
+	if s.Columns != nil {
+		c.Columns = make([]Column, len(s.Columns))
+		copy(c.Columns, s.Columns)
+	}
+	c.VoteBudgets = copyCounts(s.VoteBudgets)
+	if s.Timer != nil {
+		timer := *s.Timer
+		c.Timer = &timer
+	}
+	if s.Groups != nil {
+		c.Groups = make(map[string]*Group, len(s.Groups))
+		for id, g := range s.Groups {
+			c.Groups[id] = g.clone()
+		}
+	}
+	if s.Actions != nil {
+		c.Actions = make(map[string]*Action, len(s.Actions))
+		for id, a := range s.Actions {
+			action := *a
+			c.Actions[id] = &action
+		}
+	}
+	if s.Participants != nil {
+		c.Participants = make(map[string]*Participant, len(s.Participants))
+		for id, p := range s.Participants {
+			participant := *p
+			c.Participants[id] = &participant
+		}
+	}
+	return c
+}
+
+// stored copies the board state to store. Presence lasts as long as the
+// connections, so no participant is stored online.
+func (s *BoardState) stored() *BoardState {
+	c := s.clone()
+	for _, p := range c.Participants {
+		p.Online = false
+	}
+	return &c
+}
+
+// groupOf finds the group an item is in, nil if it isn't in one.
+func (s *BoardState) groupOf(itemId string) *Group {
+	for _, g := range s.Groups {
+		if g.itemIndex(itemId) >= 0 {
+			return g
+		}
+	}
+	return nil
+}
+
+// voteBudget is the vote budget of a participant, zero for no limit.
+func (s *BoardState) voteBudget(participantId string) int {
+	if budget, ok := s.VoteBudgets[participantId]; ok {
+		return budget
+	}
+	return s.VoteBudget
+}
+
+// columnIndex finds the position of a column, -1 if it is not there.
+func (s *BoardState) columnIndex(id string) int {
+	for i, c := range s.Columns {
+		if c.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Column of a board.
+type Column struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+	Color string `json:"color"`
+	Order int    `json:"order"`
+	// Prompt is a hint about what goes in the column.
+	Prompt string `json:"prompt"`
+}
+
+// Group is a cluster of items of a board.
+type Group struct {
+	Version uint64 `json:"version"`
+	Id      string `json:"id"`
+	Title   string `json:"title"`
+	// Items are the ids of the member items.
+	Items  []string `json:"items"`
+	Left   float32  `json:"left"`
+	Top    float32  `json:"top"`
+	Width  float32  `json:"width"`
+	Height float32  `json:"height"`
+	// Votes are the votes of the member items added up by participant.
+	Votes map[string]int `json:"votes,omitempty"`
+}
+
+// clone returns a deep copy of the group.
+func (g *Group) clone() *Group {
+	c := *g
+	if g.Items != nil {
+		c.Items = make([]string, len(g.Items))
+		copy(c.Items, g.Items)
+	}
+	c.Votes = copyCounts(g.Votes)
+	return &c
+}
+
+// itemIndex finds the position of a member item, -1 if it is not there.
+func (g *Group) itemIndex(itemId string) int {
+	for i, id := range g.Items {
+		if id == itemId {
+			return i
+		}
+	}
+	return -1
+}
+
+// Action is an action item, the outcome of a retro.
+type Action struct {
+	Version  uint64 `json:"version"`
+	Id       string `json:"id"`
+	Title    string `json:"title"`
+	Assignee string `json:"assignee"`
+	// DueDate is a date like 2006-01-02, if any.
+	DueDate string `json:"due_date"`
+	// Status is open, done or dropped.
+	Status string `json:"status"`
+	// ItemId is the card the action came from, if any. Carried actions
+	// keep the card on the board they were carried from.
+	ItemId string `json:"item_id"`
+	// CarriedFrom is the board the action was carried from, if any.
+	CarriedFrom string `json:"carried_from,omitempty"`
+}
+
+// ReactionRequest toggles the reaction of a participant with an emoji.
+type ReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// Participant of a board.
+type Participant struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	// Online marks a participant with a live connection to the board.
+	Online bool `json:"online"`
+}
+
+// CarryOver names the board to carry the open actions from.
+type CarryOver struct {
+	BoardId string `json:"board_id"`
+}
+
+// Template lays out the columns of a new board.
+type Template struct {
+	Name    string   `json:"name"`
+	Title   string   `json:"title"`
+	Columns []Column `json:"columns"`
+	// BuiltIn templates can't be changed.
+	BuiltIn bool `json:"built_in"`
+}
+
+// BoardRequest holds the options of a new board.
+type BoardRequest struct {
+	// Template is the name of the template the board is laid out with.
+	Template string `json:"template"`
+	// CarryOver is the board to carry the open actions from, if any.
+	CarryOver string `json:"carry_over"`
 }
 
 // Board data.
@@ -24,16 +278,163 @@ type Board struct {
 	Id        string           `json:"id"`
 	Items     map[string]*Item `json:"items"`
 	Version   uint64           `json:"version"`
+	BoardState
+	// DeletedItems lists the items deleted in a board update.
+	DeletedItems []string `json:"deleted_items,omitempty"`
+	// DeletedGroups lists the groups dissolved in a board update.
+	DeletedGroups []string `json:"deleted_groups,omitempty"`
+	// DeletedActions lists the actions deleted in a board update.
+	DeletedActions []string `json:"deleted_actions,omitempty"`
+	// Full marks a board update which holds the whole board instead of
+	// the changes.
+	Full bool `json:"full,omitempty"`
+	// ServerTime is when the server sent a board with a timer.
+	ServerTime *time.Time `json:"server_time,omitempty"`
+	// TextOps are the text operations merged in a board update by item id.
+	TextOps map[string][]TextOp `json:"text_ops,omitempty"`
+	// changes is the change log ordered by version.
+	changes []Change
+	// since is the version the change log starts after. Polls from an
+	// earlier version get the whole board.
+	since uint64
+	// deleted is set when the board is deleted.
+	deleted bool
+	// expiry fires when the running timer expires.
+	expiry *time.Timer
+	// heartbeats are the last heartbeats of the online participants.
+	heartbeats map[string]*heartbeat
+}
+
+// MarshalJSON encodes the board while holding its lock, so that the items
+// can't change underneath.
+func (b *Board) MarshalJSON() ([]byte, error) {
+	// board has the fields of Board without its methods.
+	type board Board
+
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+
+	return json.Marshal((*board)(b))
 }
 
 // Item of a board.
 type Item struct {
-	Version uint64  `json:"-"`
-	Id      string  `json:"id"`
-	Text    string  `json:"text"`
-	Color   string  `json:"color"`
-	Left    float32 `json:"left"`
-	Top     float32 `json:"top"`
-	Width   float32 `json:"width"`
-	Height  float32 `json:"height"`
+	Version uint64 `json:"version"`
+	Id      string `json:"id"`
+	Text    string `json:"text"`
+	Color   string `json:"color"`
+	// ColumnId is the column the item is in, if any.
+	ColumnId string  `json:"column_id"`
+	Left     float32 `json:"left"`
+	Top      float32 `json:"top"`
+	Width    float32 `json:"width"`
+	Height   float32 `json:"height"`
+	// TextDoc is the text as edited character by character, if it is.
+	TextDoc *TextDoc `json:"text_doc,omitempty"`
+	// Votes are the votes of the participants by participant id.
+	Votes map[string]int `json:"votes,omitempty"`
+	// Author is the participant who created the item.
+	Author string `json:"author"`
+	// Hidden marks an item whose text is hidden from the viewer.
+	Hidden bool `json:"hidden,omitempty"`
+	// Comments are the thread of the item, oldest first.
+	Comments []Comment `json:"comments,omitempty"`
+	// Reactions are the emoji reactions of the participants by emoji.
+	Reactions map[string]*Reaction `json:"reactions,omitempty"`
+}
+
+// Reaction counts the participants who reacted to an item with an emoji.
+type Reaction struct {
+	Count int `json:"count"`
+	// Me marks a reaction of the viewer.
+	Me bool `json:"me"`
+	// By are the participants who reacted, left out for the viewer.
+	By []string `json:"by,omitempty"`
+}
+
+// Comment of an item.
+type Comment struct {
+	Id        string     `json:"id"`
+	Author    string     `json:"author"`
+	Text      string     `json:"text"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// clone copies an item with its nested data.
+func (it *Item) clone() *Item {
+	c := *it
+	if it.TextDoc != nil {
+		c.TextDoc = it.TextDoc.clone()
+	}
+	c.Votes = copyCounts(it.Votes)
+	if it.Comments != nil {
+		c.Comments = make([]Comment, len(it.Comments))
+		copy(c.Comments, it.Comments)
+	}
+	if it.Reactions != nil {
+		c.Reactions = make(map[string]*Reaction, len(it.Reactions))
+		for emoji, r := range it.Reactions {
+			reaction := *r
+			reaction.By = append([]string(nil), r.By...)
+			c.Reactions[emoji] = &reaction
+		}
+	}
+	return &c
+}
+
+// voteCount is the number of votes on the item.
+func (it *Item) voteCount() int {
+	count := 0
+	for _, n := range it.Votes {
+		count += n
+	}
+	return count
+}
+
+// copyCounts copies a map of counts, nil stays nil.
+func copyCounts(counts map[string]int) map[string]int {
+	if counts == nil {
+		return nil
+	}
+	c := make(map[string]int, len(counts))
+	for k, v := range counts {
+		c[k] = v
+	}
+	return c
+}
+
+// VoteBudget sets the vote budget of a board, or of a participant if given.
+type VoteBudget struct {
+	ParticipantId string `json:"participant_id"`
+	Budget        int    `json:"budget"`
+}
+
+// TextEdit is a batch of character operations on the text of an item.
+type TextEdit struct {
+	Ops []TextOp `json:"ops"`
+}
+
+// SocketMessage is a message exchanged over the board web socket.
+type SocketMessage struct {
+	Type   string          `json:"type"`
+	Id     string          `json:"id,omitempty"`
+	Item   *Item           `json:"item,omitempty"`
+	Patch  json.RawMessage `json:"patch,omitempty"`
+	Ops    []TextOp        `json:"ops,omitempty"`
+	Board  *Board          `json:"board,omitempty"`
+	Cursor *Cursor         `json:"cursor,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Cursor is the pointer position of a participant on a board, with the
+// position of the item being dragged, if any.
+type Cursor struct {
+	ParticipantId string  `json:"participant_id"`
+	X             float32 `json:"x"`
+	Y             float32 `json:"y"`
+	// ItemId is the item being dragged to left and top.
+	ItemId string  `json:"item_id,omitempty"`
+	Left   float32 `json:"left,omitempty"`
+	Top    float32 `json:"top,omitempty"`
 }
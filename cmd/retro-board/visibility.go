@@ -0,0 +1,94 @@
+package main
+
+import "time"
+
+// boardView copies a board as the viewer may see it.
+func boardView(b *Board, viewer string) *Board {
+	b.Mutex.Lock()
+	view := &Board{
+		Id:         b.Id,
+		Items:      make(map[string]*Item, len(b.Items)),
+		Version:    b.Version,
+		BoardState: b.clone(),
+	}
+	for id, it := range b.Items {
+		view.Items[id] = it.clone()
+	}
+	for id, g := range b.Groups {
+		view.Groups[id] = groupView(b, g)
+	}
+	b.Mutex.Unlock()
+
+	return viewBoard(view, viewer)
+}
+
+// viewBoard prepares a copy of a board, such as a board update, for the
+// viewer. What the viewer may not see is hidden. A board with a timer gets
+// the server time, so that clients can tell their clock drift.
+func viewBoard(b *Board, viewer string) *Board {
+	for id, it := range b.Items {
+		redactItem(it, b.Visibility, viewer)
+		if it.Hidden {
+			delete(b.TextOps, id)
+		}
+	}
+	for _, g := range b.Groups {
+		g.Votes = redactVotes(g.Votes, b.Visibility, viewer)
+	}
+
+	if b.Timer != nil {
+		now := time.Now().UTC()
+		b.ServerTime = &now
+	}
+	return b
+}
+
+// itemView copies an item of a board as the viewer may see it.
+func itemView(b *Board, item *Item, viewer string) *Item {
+	b.Mutex.Lock()
+	visibility := b.Visibility
+	b.Mutex.Unlock()
+
+	view := item.clone()
+	redactItem(view, visibility, viewer)
+	return view
+}
+
+// groupViewFor copies a group of a board as the viewer may see it.
+func groupViewFor(b *Board, group *Group, viewer string) *Group {
+	b.Mutex.Lock()
+	visibility := b.Visibility
+	b.Mutex.Unlock()
+
+	view := group.clone()
+	view.Votes = redactVotes(view.Votes, visibility, viewer)
+	return view
+}
+
+// redactItem hides what the viewer may not see from a copy of an item.
+// Hidden items keep their place and color, the text and the comments are
+// left out.
+// Hidden votes are left out but the viewer's own. Reactions are counted
+// without who reacted.
+func redactItem(it *Item, visibility Visibility, viewer string) {
+	if visibility.HideCards && (viewer == "" || it.Author != viewer) {
+		it.Text = ""
+		it.TextDoc = nil
+		it.Comments = nil
+		it.Hidden = true
+	}
+
+	it.Votes = redactVotes(it.Votes, visibility, viewer)
+	redactReactions(it.Reactions, viewer)
+}
+
+// redactVotes leaves out the votes of the others if the votes are hidden.
+func redactVotes(votes map[string]int, visibility Visibility, viewer string) map[string]int {
+	if !visibility.HideVotes {
+		return votes
+	}
+	if own, ok := votes[viewer]; ok {
+		return map[string]int{viewer: own}
+	}
+	return nil
+}